@@ -7,8 +7,10 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 func ListInstances() []LimaVM {
@@ -79,12 +81,17 @@ func GetInstancesByStatus(instances []LimaVM, status string) []LimaVM {
 	return filteredInstances
 }
 
-func StopLimaVM(vmName string, wg *sync.WaitGroup, errCh chan<- error) {
+func StopLimaVM(vmName string, force bool, wg *sync.WaitGroup, errCh chan<- error) {
 	defer wg.Done()
 
 	// Define the command to spawn a Lima VM
 	cmd := exec.Command("limactl", "stop", vmName)
 
+	if force {
+		// Force stop the VM, like pulling its plug
+		cmd = exec.Command("limactl", "stop", "-f", vmName)
+	}
+
 	// Set the output to os.Stdout and os.Stderr
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -159,12 +166,27 @@ func ExecLimaVM(vmName string, command string, quiet bool) {
 	}
 }
 
-func SpawnLimaVM(vmName string, arch string, tmpl string, yqExpression string, wg *sync.WaitGroup, errCh chan<- error) {
+// ExecLimaVMWithOutput runs the command with sh inside the VM and returns its standard output
+func ExecLimaVMWithOutput(vmName string, command string) (string, error) {
+	cmd := exec.Command("limactl", "shell", vmName, "sh", "-c", command)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return string(output), fmt.Errorf("error executing command against VM %s: %w", vmName, err)
+	}
+
+	return string(output), nil
+}
+
+// SpawnLimaVM creates and starts the VM from the template, applying the yq expression.
+// env (in the KEY=VALUE form) is added to the environment of limactl, so that
+// the expression can read values with strenv() without having to quote them.
+func SpawnLimaVM(vmName string, arch string, tmpl string, yqExpression string, env []string, wg *sync.WaitGroup, errCh chan<- error) {
 	defer wg.Done()
 
 	// Define the command to spawn a Lima VM
-	limaCmd := fmt.Sprintf("limactl start --name %s %s --arch %s --tty=false --set '%s'", vmName, tmpl, arch, yqExpression)
-	cmd := exec.Command("/bin/sh", "-c", limaCmd)
+	cmd := exec.Command("limactl", "start", "--name", vmName, tmpl, "--arch", arch, "--tty=false", "--set", yqExpression)
+	cmd.Env = append(os.Environ(), env...)
 
 	// Set the output to os.Stdout and os.Stderr
 	cmd.Stdout = os.Stdout
@@ -179,6 +201,106 @@ func SpawnLimaVM(vmName string, arch string, tmpl string, yqExpression string, w
 	fmt.Printf("Lima VM %s spawned successfully.\n", vmName)
 }
 
+// SnapshotLimaVM runs the snapshot action (create, apply or delete) for the tag against the VM
+func SnapshotLimaVM(action string, vmName string, tag string) error {
+	cmd := exec.Command("limactl", "snapshot", action, vmName, "--tag", tag)
+
+	// Set the output to os.Stdout and os.Stderr
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Run the command
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running snapshot %s for Lima VM %s: %w", action, vmName, err)
+	}
+
+	fmt.Printf("Snapshot %s of Lima VM %s completed successfully (tag: %s).\n", action, vmName, tag)
+
+	return nil
+}
+
+// ListLimaVMSnapshots returns the snapshot tags of the VM
+func ListLimaVMSnapshots(vmName string) ([]string, error) {
+	cmd := exec.Command("limactl", "snapshot", "list", vmName, "--quiet")
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error listing snapshots of Lima VM %s: %w", vmName, err)
+	}
+
+	var tags []string
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if tag := strings.TrimSpace(line); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, nil
+}
+
+// CloneLimaVM clones the stopped VM into a new VM, applying the yq expression to the configuration of the clone.
+// env is added to the environment of limactl, as with SpawnLimaVM.
+func CloneLimaVM(vmName string, newVMName string, yqExpression string, env []string) error {
+	cmd := exec.Command("limactl", "clone", vmName, newVMName, "--tty=false", "--set", yqExpression)
+	cmd.Env = append(os.Environ(), env...)
+
+	// Set the output to os.Stdout and os.Stderr
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Run the command
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error cloning Lima VM %s into %s: %w", vmName, newVMName, err)
+	}
+
+	fmt.Printf("Lima VM %s cloned into %s successfully.\n", vmName, newVMName)
+
+	return nil
+}
+
+// CreateLimaVM creates a VM from the template without starting it.
+// env is added to the environment of limactl, as with SpawnLimaVM.
+func CreateLimaVM(vmName string, tmpl string, yqExpression string, env []string) error {
+	cmd := exec.Command("limactl", "create", "--name", vmName, "--tty=false", tmpl, "--set", yqExpression)
+	cmd.Env = append(os.Environ(), env...)
+
+	// Set the output to os.Stdout and os.Stderr
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Run the command
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error creating Lima VM %s: %w", vmName, err)
+	}
+
+	fmt.Printf("Lima VM %s created successfully.\n", vmName)
+
+	return nil
+}
+
+// CopyFromLimaVM copies the file at guestPath inside the VM to hostPath
+func CopyFromLimaVM(vmName string, guestPath string, hostPath string) error {
+	cmd := exec.Command("limactl", "copy", fmt.Sprintf("%s:%s", vmName, guestPath), hostPath)
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error copying %s from Lima VM %s: %w: %s", guestPath, vmName, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// CopyToLimaVM copies the file at hostPath to guestPath inside the VM
+func CopyToLimaVM(vmName string, hostPath string, guestPath string) error {
+	cmd := exec.Command("limactl", "copy", hostPath, fmt.Sprintf("%s:%s", vmName, guestPath))
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error copying %s to Lima VM %s: %w: %s", hostPath, vmName, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
 func ShellLimaVM(vmName string) {
 
 	limaCmd := fmt.Sprintf("limactl shell '%s'", vmName)
@@ -197,6 +319,16 @@ func ShellLimaVM(vmName string) {
 	cmd.Wait()
 }
 
+// GetZoneFromEnv returns the zone the VM was placed in, if any
+func (vm LimaVM) GetZoneFromEnv() string {
+	return vm.Config.Env["SHIKARI_ZONE"]
+}
+
+// GetRackFromEnv returns the rack the VM was placed in, if any
+func (vm LimaVM) GetRackFromEnv() string {
+	return vm.Config.Env["SHIKARI_RACK"]
+}
+
 func (vm LimaVM) GetScenarioNameFromEnv() string {
 
 	scenario_name := ""
@@ -212,6 +344,17 @@ func (vm LimaVM) GetScenarioNameFromEnv() string {
 	return scenario_name
 }
 
+// StartedAt returns when the running VM was last started, from the pid file of
+// its host agent. ok is false when the VM is not running.
+func (vm LimaVM) StartedAt() (time.Time, bool) {
+	info, err := os.Stat(filepath.Join(vm.Dir, "ha.pid"))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return info.ModTime(), true
+}
+
 func (vm LimaVM) GetVMDir() string {
 	return vm.Dir
 }
@@ -248,3 +391,8 @@ func (vm LimaVM) GetIPAddress() string {
 	}
 	return ""
 }
+
+// ShellQuote quotes the string so that it is passed as a single word to the shell inside the VM
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
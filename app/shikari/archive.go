@@ -0,0 +1,518 @@
+package shikari
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// Layout of the archive. The state file always comes first, followed by the
+// rest of the state directory, and the files of every VM with its lima.yaml
+// before its disks, so that the archive can be imported in a single pass.
+const (
+	archiveStateDir     = "state"
+	archiveInstancesDir = "instances"
+)
+
+// instanceArchiveFiles are the files of the Lima instance directory that make
+// up a VM. Everything else is regenerated by Lima.
+var instanceArchiveFiles = []string{"lima.yaml", "basedisk", "diffdisk", "copied-from-guest"}
+
+// Export packages the state of the cluster and the configuration and disks of
+// every VM into an archive, readable only by the user. The compression is
+// picked from the file extension (.tar.zst, .tar.gz or .tar). The secrets of
+// the state directory (see isSecretFile) are left out unless includeSecrets is
+// set. The VMs are stopped while being exported and the ones that were running
+// are started again afterwards.
+func (c ShikariCluster) Export(archivePath string, includeSecrets bool) error {
+	var vms []lima.LimaVM
+	for _, vm := range lima.GetInstancesByPrefix(c.Name) {
+		if _, ok := c.getInstanceIndex(vm.Name); ok {
+			vms = append(vms, vm)
+		}
+	}
+
+	if len(vms) == 0 {
+		return fmt.Errorf("no instances in the cluster %s", c.Name)
+	}
+
+	state, err := LoadState(c.Name)
+	if err != nil {
+		return err
+	}
+
+	running, err := c.stopRunningInstances()
+	if err != nil {
+		// start the VMs that did stop, rather than leaving them down
+		return errors.Join(err, startInstances(running))
+	}
+
+	exportErr := c.writeArchive(archivePath, state, vms, includeSecrets)
+
+	return errors.Join(exportErr, startInstances(running))
+}
+
+func (c ShikariCluster) writeArchive(archivePath string, state ClusterState, vms []lima.LimaVM, includeSecrets bool) (err error) {
+	f, err := os.OpenFile(archivePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	// an existing file keeps its mode otherwise
+	if err := f.Chmod(0600); err != nil {
+		return err
+	}
+
+	var cw io.WriteCloser
+
+	switch {
+	case strings.HasSuffix(archivePath, ".zst") || strings.HasSuffix(archivePath, ".tzst"):
+		cw, err = zstd.NewWriter(f)
+		if err != nil {
+			return err
+		}
+	case strings.HasSuffix(archivePath, ".gz") || strings.HasSuffix(archivePath, ".tgz"):
+		cw = gzip.NewWriter(f)
+	default:
+		cw = nopWriteCloser{f}
+	}
+	defer func() {
+		err = errors.Join(err, cw.Close())
+	}()
+
+	tw := tar.NewWriter(cw)
+	defer func() {
+		err = errors.Join(err, tw.Close())
+	}()
+
+	stateData, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name: path.Join(archiveStateDir, stateFileName),
+		Mode: 0600,
+		Size: int64(len(stateData)),
+	}); err != nil {
+		return err
+	}
+
+	if _, err := tw.Write(stateData); err != nil {
+		return err
+	}
+
+	stateDir, err := StateDir(c.Name)
+	if err != nil {
+		return err
+	}
+
+	// the staged files are staged again on import
+	include := func(rel string) bool {
+		return rel != stateFileName && !isStagedFile(rel) && (includeSecrets || !isSecretFile(rel))
+	}
+
+	if err := addToArchive(tw, stateDir, archiveStateDir, include); err != nil {
+		return err
+	}
+
+	for _, vm := range vms {
+		// murphy-srv-01 -> instances/srv-01
+		archiveDir := path.Join(archiveInstancesDir, strings.TrimPrefix(vm.Name, c.Name+"-"))
+
+		for _, name := range instanceArchiveFiles {
+			src := filepath.Join(vm.GetVMDir(), name)
+
+			if _, err := os.Stat(src); errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+
+			fmt.Printf("Exporting %s of %s\n", name, vm.Name)
+
+			if err := addToArchive(tw, src, path.Join(archiveDir, name), nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// isSecretFile reports whether the path relative to the state directory is
+// one of the secrets of the cluster: the CA key, the Vault unseal keys and
+// root token, and the secrets passed with --secret
+func isSecretFile(rel string) bool {
+	switch rel {
+	case filepath.Join(pkiDir, caKeyFile), VaultInitFile, VaultRootTokenFile:
+		return true
+	}
+
+	return rel == secretsDir || strings.HasPrefix(rel, secretsDir+string(filepath.Separator))
+}
+
+// addToArchive adds the file or directory at src to the archive under the
+// name dst. Files for which include returns false are skipped.
+func addToArchive(tw *tar.Writer, src string, dst string, include func(rel string) bool) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == src {
+			return filepath.SkipDir // nothing to add
+		}
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+
+		if include != nil && !include(rel) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil // skip sockets, symlinks and the like
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = path.Join(dst, filepath.ToSlash(rel))
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+
+		return err
+	})
+}
+
+// Import restores a cluster from an archive created by Export. The cluster
+// keeps its original name unless a new name is given. The imported VMs are
+// left stopped. If the import fails, the VMs and the state it created are
+// removed again. It returns the name of the imported cluster.
+func Import(archivePath string, name string) (string, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	r, err := decompressReader(f)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	tr := tar.NewReader(r)
+
+	state, err := readArchiveState(tr)
+	if err != nil {
+		return "", fmt.Errorf("%s is not a Shikari cluster archive: %w", archivePath, err)
+	}
+
+	if name == "" {
+		name = state.Name
+	}
+
+	c := ShikariCluster{Name: name}
+
+	if !c.validateName() {
+		return "", fmt.Errorf("cluster name can only contain alphanumeric characters")
+	}
+
+	if len(lima.GetInstancesByPrefix(name)) > 0 {
+		return "", fmt.Errorf("cluster %s already exists", name)
+	}
+
+	stateDir, err := StateDir(name)
+	if err != nil {
+		return "", err
+	}
+
+	_, statErr := os.Stat(stateDir)
+	stateExisted := statErr == nil
+
+	imp := archiveImporter{
+		name:           name,
+		stateDir:       stateDir,
+		state:          state,
+		createInstance: createInstanceFromArchive,
+	}
+
+	if err := imp.extract(tr); err != nil {
+		return "", errors.Join(err, imp.cleanup(stateExisted))
+	}
+
+	return name, nil
+}
+
+// readArchiveState reads the state file at the start of the archive
+func readArchiveState(tr *tar.Reader) (ClusterState, error) {
+	var state ClusterState
+
+	hdr, err := tr.Next()
+	if err != nil {
+		return state, err
+	}
+
+	if hdr.Name != path.Join(archiveStateDir, stateFileName) {
+		return state, fmt.Errorf("unexpected first entry %s", hdr.Name)
+	}
+
+	err = json.NewDecoder(tr).Decode(&state)
+
+	return state, err
+}
+
+// archiveImporter restores the entries of an archive following the state file
+type archiveImporter struct {
+	name     string // name of the imported cluster
+	stateDir string
+	state    ClusterState
+
+	// createInstance creates the Lima instance of a VM from its lima.yaml
+	// and returns the directory of the instance
+	createInstance func(r io.Reader, vmName string, yqExpression string, env []string) (string, error)
+
+	created []string // VMs created so far
+}
+
+func (imp *archiveImporter) extract(tr *tar.Reader) error {
+	imp.state.Name = imp.name
+	imp.state.ClonedFrom = ""
+	imp.state.Faults = nil
+
+	yqExpression := fmt.Sprintf(`.env.SHIKARI_CLUSTER_NAME="%s"`, imp.name)
+
+	// directory of the Lima instance the disks of the current VM go into
+	instanceDirs := make(map[string]string)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if !filepath.IsLocal(hdr.Name) {
+			return fmt.Errorf("invalid path %s in archive", hdr.Name)
+		}
+
+		parts := strings.SplitN(hdr.Name, "/", 3)
+
+		switch {
+		case parts[0] == archiveStateDir && len(parts) > 1:
+			err = extractArchiveEntry(tr, hdr, filepath.Join(imp.stateDir, filepath.FromSlash(strings.Join(parts[1:], "/"))))
+
+		case parts[0] == archiveInstancesDir && len(parts) == 3 && parts[2] == "lima.yaml":
+			vmName := fmt.Sprintf("%s-%s", imp.name, parts[1])
+
+			// the state directory, including the CA, has been extracted by now
+			var provisionExpr string
+			var provisionEnv []string
+
+			provisionExpr, provisionEnv, err = imp.state.provisionExpression(vmName)
+			if err != nil {
+				return err
+			}
+
+			expr := yqExpression
+			if provisionExpr != "" {
+				expr = fmt.Sprintf("%s | %s", expr, provisionExpr)
+			}
+
+			instanceDirs[parts[1]], err = imp.createInstance(tr, vmName, expr, provisionEnv)
+			if err == nil {
+				imp.created = append(imp.created, vmName)
+			}
+
+		case parts[0] == archiveInstancesDir && len(parts) == 3:
+			dir, ok := instanceDirs[parts[1]]
+			if !ok {
+				return fmt.Errorf("invalid archive: %s comes before the lima.yaml of the VM", hdr.Name)
+			}
+
+			err = extractArchiveEntry(tr, hdr, filepath.Join(dir, filepath.FromSlash(parts[2])))
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return imp.state.Save()
+}
+
+// cleanup deletes the VMs created by the import, and the state directory
+// unless it existed before
+func (imp *archiveImporter) cleanup(stateExisted bool) error {
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(imp.created))
+
+	for _, vmName := range imp.created {
+		wg.Add(1)
+		go lima.DeleteLimaVM(vmName, true, &wg, errCh)
+	}
+
+	wg.Wait()
+	close(errCh)
+
+	var errs []error
+	for err := range errCh {
+		errs = append(errs, err)
+	}
+
+	if !stateExisted {
+		errs = append(errs, DeleteState(imp.name))
+	}
+
+	return errors.Join(errs...)
+}
+
+func createInstanceFromArchive(r io.Reader, vmName string, yqExpression string, env []string) (string, error) {
+	tmpl, err := os.CreateTemp("", fmt.Sprintf("%s-*.yaml", vmName))
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpl.Name())
+
+	if _, err := io.Copy(tmpl, r); err != nil {
+		tmpl.Close()
+		return "", err
+	}
+	tmpl.Close()
+
+	if err := lima.CreateLimaVM(vmName, tmpl.Name(), yqExpression, env); err != nil {
+		return "", err
+	}
+
+	vm := lima.GetInstance(vmName)
+	if vm.Name == "" {
+		return "", fmt.Errorf("created Lima VM %s not found", vmName)
+	}
+
+	return vm.GetVMDir(), nil
+}
+
+func extractArchiveEntry(r io.Reader, hdr *tar.Header, dst string) error {
+	if hdr.Typeflag == tar.TypeDir {
+		return os.MkdirAll(dst, 0700)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, hdr.FileInfo().Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(copySparse(file, r), file.Close())
+}
+
+// sparseBlockSize is the size of the blocks copySparse checks for zeros
+const sparseBlockSize = 64 * 1024
+
+// copySparse copies r into the file, seeking over the blocks of zeros instead
+// of writing them, so that the (mostly empty) disks of the VMs stay sparse.
+func copySparse(file *os.File, r io.Reader) error {
+	buf := make([]byte, sparseBlockSize)
+	zeros := make([]byte, sparseBlockSize)
+
+	var size int64
+
+	for {
+		n, err := io.ReadFull(r, buf)
+
+		if n > 0 {
+			if bytes.Equal(buf[:n], zeros[:n]) {
+				_, serr := file.Seek(int64(n), io.SeekCurrent)
+				if serr != nil {
+					return serr
+				}
+			} else if _, werr := file.Write(buf[:n]); werr != nil {
+				return werr
+			}
+
+			size += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			// a trailing hole has to be materialized by the file size
+			return file.Truncate(size)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// decompressReader detects the compression of the archive from its magic bytes
+func decompressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+
+		return zr.IOReadCloser(), nil
+	case bytes.Equal(magic[:2], []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	}
+
+	return io.NopCloser(br), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
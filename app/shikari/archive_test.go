@@ -0,0 +1,273 @@
+package shikari
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// setupArchiveCluster creates the state of the cluster murphy and a VM
+// directory holding the files of murphy-srv-01 in a temporary home directory
+func setupArchiveCluster(t *testing.T) (ShikariCluster, ClusterState, []lima.LimaVM, []byte) {
+	t.Helper()
+
+	t.Setenv("HOME", t.TempDir())
+
+	c := ShikariCluster{Name: "murphy"}
+	state := ClusterState{Name: c.Name, Template: "hashibox.yaml", Zones: []string{"a", "b"}}
+
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	stateDir, err := StateDir(c.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(stateDir, "chaos.log"), []byte("partition\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	vmDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(vmDir, "lima.yaml"), []byte("vmType: qemu\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// a disk with data between runs of zeros, ending in a hole
+	disk := make([]byte, 4*sparseBlockSize+100)
+	copy(disk[sparseBlockSize+10:], "data")
+
+	if err := os.WriteFile(filepath.Join(vmDir, "diffdisk"), disk, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return c, state, []lima.LimaVM{{Name: "murphy-srv-01", Dir: vmDir}}, disk
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	for _, ext := range []string{".tar", ".tar.gz", ".tar.zst"} {
+		t.Run(ext, func(t *testing.T) {
+			c, state, vms, disk := setupArchiveCluster(t)
+
+			archivePath := filepath.Join(t.TempDir(), "murphy"+ext)
+
+			if err := c.writeArchive(archivePath, state, vms, false); err != nil {
+				t.Fatalf("writeArchive: %v", err)
+			}
+
+			f, err := os.Open(archivePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			r, err := decompressReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			tr := tar.NewReader(r)
+
+			got, err := readArchiveState(tr)
+			if err != nil {
+				t.Fatalf("readArchiveState: %v", err)
+			}
+
+			stateDir, err := StateDir("copy")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			instanceDir := t.TempDir()
+			var yaml, expr string
+
+			imp := archiveImporter{
+				name:     "copy",
+				stateDir: stateDir,
+				state:    got,
+				createInstance: func(r io.Reader, vmName string, yqExpression string, env []string) (string, error) {
+					if vmName != "copy-srv-01" {
+						t.Errorf("createInstance called for %s, want copy-srv-01", vmName)
+					}
+
+					data, err := io.ReadAll(r)
+					yaml, expr = string(data), yqExpression
+
+					return instanceDir, err
+				},
+			}
+
+			if err := imp.extract(tr); err != nil {
+				t.Fatalf("extract: %v", err)
+			}
+
+			if yaml != "vmType: qemu\n" {
+				t.Errorf("lima.yaml = %q", yaml)
+			}
+
+			if !strings.Contains(expr, `.env.SHIKARI_CLUSTER_NAME="copy"`) {
+				t.Errorf("yq expression %q does not rename the cluster", expr)
+			}
+
+			imported, err := LoadState("copy")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if imported.Template != state.Template || len(imported.Zones) != 2 {
+				t.Errorf("imported state = %+v, want the state of murphy", imported)
+			}
+
+			chaosLog, err := os.ReadFile(filepath.Join(stateDir, "chaos.log"))
+			if err != nil || string(chaosLog) != "partition\n" {
+				t.Errorf("chaos.log = %q, %v", chaosLog, err)
+			}
+
+			gotDisk, err := os.ReadFile(filepath.Join(instanceDir, "diffdisk"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(gotDisk, disk) {
+				t.Errorf("diffdisk differs after the round trip (%d bytes, want %d)", len(gotDisk), len(disk))
+			}
+		})
+	}
+}
+
+func TestArchiveImportCleanup(t *testing.T) {
+	c, state, vms, _ := setupArchiveCluster(t)
+
+	archivePath := filepath.Join(t.TempDir(), "murphy.tar")
+
+	if err := c.writeArchive(archivePath, state, vms, false); err != nil {
+		t.Fatalf("writeArchive: %v", err)
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+
+	got, err := readArchiveState(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stateDir, err := StateDir("copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createErr := errors.New("limactl failed")
+
+	imp := archiveImporter{
+		name:     "copy",
+		stateDir: stateDir,
+		state:    got,
+		createInstance: func(io.Reader, string, string, []string) (string, error) {
+			return "", createErr
+		},
+	}
+
+	if err := imp.extract(tr); !errors.Is(err, createErr) {
+		t.Fatalf("extract = %v, want %v", err, createErr)
+	}
+
+	if err := imp.cleanup(false); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+
+	if _, err := os.Stat(stateDir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("state directory %s left behind after a failed import", stateDir)
+	}
+}
+
+func TestArchiveSecrets(t *testing.T) {
+	c, state, vms, _ := setupArchiveCluster(t)
+
+	stateDir, err := StateDir(c.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secrets := []string{"secrets/CONSUL_LICENSE", "pki/ca-key.pem", VaultInitFile, VaultRootTokenFile}
+
+	for _, name := range append([]string{"pki/ca.pem"}, secrets...) {
+		p := filepath.Join(stateDir, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(p, []byte("secret"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, includeSecrets := range []bool{false, true} {
+		archivePath := filepath.Join(t.TempDir(), "murphy.tar")
+
+		// an existing archive gets its mode fixed as well
+		if err := os.WriteFile(archivePath, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.writeArchive(archivePath, state, vms, includeSecrets); err != nil {
+			t.Fatalf("writeArchive: %v", err)
+		}
+
+		info, err := os.Stat(archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("archive mode = %v, want 0600", info.Mode().Perm())
+		}
+
+		f, err := os.Open(archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries := make(map[string]bool)
+		tr := tar.NewReader(f)
+
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entries[hdr.Name] = true
+		}
+		f.Close()
+
+		if !entries["state/pki/ca.pem"] {
+			t.Errorf("state/pki/ca.pem missing from the archive")
+		}
+
+		for _, name := range secrets {
+			if got := entries["state/"+name]; got != includeSecrets {
+				t.Errorf("includeSecrets=%t: state/%s in archive = %t", includeSecrets, name, got)
+			}
+		}
+	}
+}
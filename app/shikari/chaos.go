@@ -0,0 +1,233 @@
+package shikari
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// Fault is a fault injected into VMs of the cluster. It is kept in the cluster
+// state until healed, along with the commands reverting it on each VM.
+type Fault struct {
+	ID        string            `json:"id"`
+	Kind      string            `json:"kind"`
+	Details   string            `json:"details"`
+	Undo      map[string]string `json:"undo"` // VM name -> command reverting the fault
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"` // when the fault reverts itself, if it does
+}
+
+// Expired reports whether the fault has reverted itself
+func (f Fault) Expired() bool {
+	return f.ExpiresAt != nil && time.Now().After(*f.ExpiresAt)
+}
+
+// Targets returns the sorted names of the VMs affected by the fault
+func (f Fault) Targets() []string {
+	var names []string
+
+	for vmName := range f.Undo {
+		names = append(names, vmName)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// ListFaults returns the faults of the cluster. The ones that have expired
+// are kept, so that they show up until healed.
+func (c ShikariCluster) ListFaults() ([]Fault, error) {
+	state, err := LoadState(c.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return state.Faults, nil
+}
+
+// activeOn reports whether the fault is still in place on the VM, which loses
+// it when stopped or restarted after the fault was injected
+func (f Fault) activeOn(vm lima.LimaVM) bool {
+	if strings.ToLower(vm.Status) != "running" {
+		return false
+	}
+
+	startedAt, ok := vm.StartedAt()
+
+	return !ok || !startedAt.After(f.CreatedAt)
+}
+
+// LostOn returns the sorted names of the target VMs that have lost the fault,
+// as they are gone, stopped or restarted since it was injected
+func (f Fault) LostOn(vms []lima.LimaVM) []string {
+	var lost []string
+
+	for _, vmName := range f.Targets() {
+		i := slices.IndexFunc(vms, func(vm lima.LimaVM) bool { return vm.Name == vmName })
+
+		if i < 0 || !f.activeOn(vms[i]) {
+			lost = append(lost, vmName)
+		}
+	}
+
+	return lost
+}
+
+// injectFault runs the apply command of every VM and records the fault in
+// the cluster state. If a VM fails, the VMs done so far are reverted.
+func (s ClusterState) injectFault(fault Fault, apply map[string]string) (Fault, error) {
+	fault.ID = s.nextFaultID(fault.Kind)
+	fault.CreatedAt = time.Now()
+
+	var applied []string
+
+	for _, vmName := range fault.Targets() {
+		if output, err := lima.ExecLimaVMWithOutput(vmName, apply[vmName]); err != nil {
+			for _, done := range applied {
+				lima.ExecLimaVMWithOutput(done, fault.Undo[done])
+			}
+
+			return fault, fmt.Errorf("error injecting %s into %s: %w: %s", fault.Kind, vmName, err, strings.TrimSpace(output))
+		}
+
+		applied = append(applied, vmName)
+	}
+
+	s.Faults = append(s.Faults, fault)
+
+	return fault, s.Save()
+}
+
+// Heal reverts the fault with the given ID, or all the faults of the cluster
+// when id is empty, including the expired ones. VMs that are no longer running, or were restarted since
+// the fault was injected, have lost it, so nothing is reverted on them.
+func (c ShikariCluster) Heal(id string) ([]Fault, error) {
+	state, err := LoadState(c.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if id != "" && !slices.ContainsFunc(state.Faults, func(f Fault) bool { return f.ID == id }) {
+		return nil, fmt.Errorf("fault %s not found in cluster %s", id, c.Name)
+	}
+
+	vms := make(map[string]lima.LimaVM)
+
+	for _, vm := range lima.GetInstancesByPrefix(c.Name) {
+		vms[vm.Name] = vm
+	}
+
+	var healed, remaining []Fault
+	var errs []error
+
+	// revert the faults in the reverse order they were injected in
+	for i := len(state.Faults) - 1; i >= 0; i-- {
+		fault := state.Faults[i]
+
+		if id != "" && fault.ID != id {
+			remaining = append([]Fault{fault}, remaining...)
+			continue
+		}
+
+		for _, vmName := range fault.Targets() {
+			if !fault.activeOn(vms[vmName]) {
+				delete(fault.Undo, vmName)
+				continue
+			}
+
+			if output, err := lima.ExecLimaVMWithOutput(vmName, fault.Undo[vmName]); err != nil {
+				errs = append(errs, fmt.Errorf("error healing %s on %s: %w: %s", fault.ID, vmName, err, strings.TrimSpace(output)))
+				continue
+			}
+
+			delete(fault.Undo, vmName)
+		}
+
+		// keep what could not be reverted, so that heal can be retried
+		if len(fault.Undo) > 0 {
+			remaining = append([]Fault{fault}, remaining...)
+			continue
+		}
+
+		healed = append(healed, fault)
+	}
+
+	state.Faults = remaining
+
+	if err := state.Save(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return healed, errors.Join(errs...)
+}
+
+// forgetFaults drops the VMs from the faults of the cluster, eg: after they
+// were stopped, and the faults left without any VM
+func (c ShikariCluster) forgetFaults(vmNames []string) error {
+	if len(vmNames) == 0 {
+		return nil
+	}
+
+	state, err := LoadState(c.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, fault := range state.Faults {
+		for _, vmName := range vmNames {
+			delete(fault.Undo, vmName)
+		}
+	}
+
+	state.Faults = slices.DeleteFunc(state.Faults, func(f Fault) bool { return len(f.Undo) == 0 })
+
+	return state.Save()
+}
+
+// nextFaultID returns the ID of the next fault of the kind, eg: latency-2
+func (s ClusterState) nextFaultID(kind string) string {
+	var last int
+
+	for _, f := range s.Faults {
+		if n, ok := strings.CutPrefix(f.ID, kind+"-"); ok {
+			if i, err := strconv.Atoi(n); err == nil && i > last {
+				last = i
+			}
+		}
+	}
+
+	return fmt.Sprintf("%s-%d", kind, last+1)
+}
+
+// faultOf returns the active fault of one of the kinds affecting the VM, if any
+func (s ClusterState) faultOf(vm lima.LimaVM, kinds ...string) (Fault, bool) {
+	for _, f := range s.Faults {
+		if _, ok := f.Undo[vm.Name]; ok && slices.Contains(kinds, f.Kind) && !f.Expired() && f.activeOn(vm) {
+			return f, true
+		}
+	}
+
+	return Fault{}, false
+}
+
+// runningTargets returns the VMs matching the selector, all of which must be running
+func (c ShikariCluster) runningTargets(selector string) ([]lima.LimaVM, error) {
+	vms, err := c.SelectInstances(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, vm := range vms {
+		if strings.ToLower(vm.Status) != "running" {
+			return nil, fmt.Errorf("VM %s is not running", vm.Name)
+		}
+	}
+
+	return vms, nil
+}
@@ -0,0 +1,178 @@
+package shikari
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+func TestNextFaultID(t *testing.T) {
+	state := ClusterState{Faults: []Fault{
+		{ID: "partition-1"},
+		{ID: "latency-3"},
+		{ID: "partition-2"},
+		{ID: "latency-x"},
+	}}
+
+	tests := []struct {
+		kind string
+		want string
+	}{
+		{"partition", "partition-3"},
+		{"latency", "latency-4"},
+		{"loss", "loss-1"},
+	}
+
+	for _, tt := range tests {
+		if got := state.nextFaultID(tt.kind); got != tt.want {
+			t.Errorf("nextFaultID(%q) = %q, want %q", tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestFaultActiveOn(t *testing.T) {
+	vmDir := t.TempDir()
+	pidFile := filepath.Join(vmDir, "ha.pid")
+
+	if err := os.WriteFile(pidFile, []byte("42\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	startedAt := time.Now().Add(-time.Hour)
+
+	if err := os.Chtimes(pidFile, startedAt, startedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		status    string
+		dir       string
+		createdAt time.Time
+		want      bool
+	}{
+		{"injected after the start", "Running", vmDir, startedAt.Add(time.Minute), true},
+		{"restarted since", "Running", vmDir, startedAt.Add(-time.Minute), false},
+		{"stopped", "Stopped", vmDir, startedAt.Add(time.Minute), false},
+		{"unknown start time", "Running", t.TempDir(), startedAt.Add(-time.Minute), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := lima.LimaVM{Name: "murphy-srv-01", Status: tt.status, Dir: tt.dir}
+
+			if got := (Fault{CreatedAt: tt.createdAt}).activeOn(vm); got != tt.want {
+				t.Errorf("activeOn = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForgetFaults(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	c := ShikariCluster{Name: "murphy"}
+	state := ClusterState{Name: c.Name, Faults: []Fault{
+		{ID: "partition-1", Undo: map[string]string{"murphy-srv-01": "undo", "murphy-srv-02": "undo"}},
+		{ID: "latency-1", Undo: map[string]string{"murphy-srv-01": "undo"}},
+	}}
+
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.forgetFaults([]string{"murphy-srv-01"}); err != nil {
+		t.Fatalf("forgetFaults: %v", err)
+	}
+
+	got, err := LoadState(c.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Faults) != 1 || got.Faults[0].ID != "partition-1" {
+		t.Fatalf("faults = %+v, want only partition-1", got.Faults)
+	}
+
+	if targets := got.Faults[0].Targets(); len(targets) != 1 || targets[0] != "murphy-srv-02" {
+		t.Errorf("partition-1 targets = %v, want [murphy-srv-02]", targets)
+	}
+}
+
+func TestListFaultsKeepsExpired(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	expiredAt := time.Now().Add(-time.Minute)
+
+	c := ShikariCluster{Name: "murphy"}
+	state := ClusterState{Name: c.Name, Faults: []Fault{
+		{ID: "stress-1", Undo: map[string]string{"murphy-cli-01": "undo"}, ExpiresAt: &expiredAt},
+		{ID: "latency-1", Undo: map[string]string{"murphy-srv-01": "undo"}},
+	}}
+
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	faults, err := c.ListFaults()
+	if err != nil {
+		t.Fatalf("ListFaults: %v", err)
+	}
+
+	if len(faults) != 2 || !faults[0].Expired() || faults[1].Expired() {
+		t.Fatalf("faults = %+v, want the expired stress-1 and the active latency-1", faults)
+	}
+
+	if got, err := LoadState(c.Name); err != nil || len(got.Faults) != 2 {
+		t.Errorf("state faults = %+v, %v, want both kept until healed", got.Faults, err)
+	}
+}
+
+func TestFaultLostOn(t *testing.T) {
+	vmDir := t.TempDir()
+	pidFile := filepath.Join(vmDir, "ha.pid")
+
+	if err := os.WriteFile(pidFile, []byte("42\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	startedAt := time.Now().Add(-time.Hour)
+
+	if err := os.Chtimes(pidFile, startedAt, startedAt); err != nil {
+		t.Fatal(err)
+	}
+
+	fault := Fault{
+		CreatedAt: startedAt.Add(time.Minute),
+		Undo: map[string]string{
+			"murphy-srv-01": "undo",
+			"murphy-srv-02": "undo",
+			"murphy-srv-03": "undo",
+			"murphy-srv-04": "undo",
+		},
+	}
+
+	restartedDir := t.TempDir()
+	restartedPid := filepath.Join(restartedDir, "ha.pid")
+
+	if err := os.WriteFile(restartedPid, []byte("43\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	vms := []lima.LimaVM{
+		{Name: "murphy-srv-01", Status: "Running", Dir: vmDir},
+		{Name: "murphy-srv-02", Status: "Running", Dir: restartedDir}, // restarted just now
+		{Name: "murphy-srv-03", Status: "Stopped", Dir: vmDir},
+		// murphy-srv-04 is gone
+	}
+
+	want := []string{"murphy-srv-02", "murphy-srv-03", "murphy-srv-04"}
+
+	if got := fault.LostOn(vms); !slices.Equal(got, want) {
+		t.Errorf("LostOn = %v, want %v", got, want)
+	}
+}
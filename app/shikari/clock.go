@@ -0,0 +1,102 @@
+package shikari
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// timeSyncServices are the time synchronization services stopped while the clock is skewed
+var timeSyncServices = []string{"systemd-timesyncd", "chronyd", "chrony", "ntp", "ntpd"}
+
+// Clock offsets the system clock of the VMs matching the selector, stopping
+// the time synchronization of the guests while skewed. The clock is restored
+// when healed, or after the duration unless zero.
+func (c ShikariCluster) Clock(selector string, offset time.Duration, duration time.Duration) (Fault, error) {
+	seconds := int64(offset.Seconds())
+
+	if seconds == 0 {
+		return Fault{}, fmt.Errorf("the offset must be at least 1s, eg: 5m or -30s")
+	}
+
+	if duration != 0 && duration < time.Second {
+		return Fault{}, fmt.Errorf("the duration must be at least 1s, or zero to skew the clock until healed")
+	}
+
+	vms, err := c.runningTargets(selector)
+	if err != nil {
+		return Fault{}, err
+	}
+
+	state, err := LoadState(c.Name)
+	if err != nil {
+		return Fault{}, err
+	}
+
+	for _, vm := range vms {
+		if f, ok := state.faultOf(vm, "clock"); ok {
+			return Fault{}, fmt.Errorf("VM %s already has fault %s (%s), heal it first", vm.Name, f.ID, f.Details)
+		}
+	}
+
+	unit := "shikari-" + state.nextFaultID("clock")
+
+	// the marker makes the restore idempotent, and is gone along with the skew when the VM restarts
+	marker := fmt.Sprintf("/run/%s.skewed", unit)
+
+	services := strings.Join(timeSyncServices, " ")
+
+	skew := strings.Join([]string{
+		"set -e",
+		"timedatectl set-ntp false 2>/dev/null || true",
+		fmt.Sprintf("for s in %s; do systemctl stop $s 2>/dev/null || true; done", services),
+		fmt.Sprintf("date -s @$(( $(date +%%s) + %d )) >/dev/null", seconds),
+		"touch " + marker,
+	}, "\n")
+
+	restore := strings.Join([]string{
+		fmt.Sprintf("if [ -e %[1]s ]; then date -s @$(( $(date +%%s) - %[2]d )) >/dev/null && rm -f %[1]s; fi", marker, seconds),
+		"timedatectl set-ntp true 2>/dev/null || true",
+		fmt.Sprintf("for s in %s; do if systemctl is-enabled --quiet $s 2>/dev/null; then systemctl start $s; fi; done", services),
+		fmt.Sprintf("test ! -e %s", marker),
+	}, "\n")
+
+	apply := fmt.Sprintf("sudo sh -c %s", lima.ShellQuote(skew))
+	undo := fmt.Sprintf("sudo systemctl stop %s.timer 2>/dev/null; sudo sh -c %s", unit, lima.ShellQuote(restore))
+
+	fault := Fault{
+		Kind:    "clock",
+		Details: fmt.Sprintf("offset %s on %s", formatOffset(offset), selector),
+		Undo:    make(map[string]string),
+	}
+
+	if duration > 0 {
+		// restore the clock from a timer inside the VM, so that it does not depend on the host
+		apply = fmt.Sprintf("%s && sudo systemd-run --quiet --collect --unit %s --on-active=%ds sh -c %s",
+			apply, unit, int64(duration.Seconds()), lima.ShellQuote(restore))
+
+		expiresAt := time.Now().Add(duration)
+		fault.ExpiresAt = &expiresAt
+		fault.Details = fmt.Sprintf("%s for %s", fault.Details, duration)
+	}
+
+	applies := make(map[string]string)
+
+	for _, vm := range vms {
+		applies[vm.Name] = apply
+		fault.Undo[vm.Name] = undo
+	}
+
+	return state.injectFault(fault, applies)
+}
+
+// formatOffset returns the offset with an explicit sign, eg: +5m0s
+func formatOffset(offset time.Duration) string {
+	if offset > 0 {
+		return "+" + offset.String()
+	}
+
+	return offset.String()
+}
@@ -0,0 +1,121 @@
+package shikari
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// Clone duplicates every VM of the cluster into a new cluster and records the
+// new cluster in the state. The VMs have to be stopped while being cloned; the
+// ones that were running are started again afterwards. The cloned VMs are only
+// started when start is set.
+func (c ShikariCluster) Clone(newName string, start bool) error {
+	clone := ShikariCluster{Name: newName}
+
+	if !clone.validateName() {
+		return fmt.Errorf("cluster name can only contain alphanumeric characters")
+	}
+
+	if len(lima.GetInstancesByPrefix(newName)) > 0 {
+		return fmt.Errorf("cluster %s already exists", newName)
+	}
+
+	var vms []string
+	for _, vm := range lima.GetInstancesByPrefix(c.Name) {
+		if _, ok := c.getInstanceIndex(vm.Name); ok {
+			vms = append(vms, vm.Name)
+		}
+	}
+
+	if len(vms) == 0 {
+		return fmt.Errorf("no instances in the cluster %s", c.Name)
+	}
+
+	state, err := c.prepareClone(newName)
+	if err != nil {
+		return err
+	}
+
+	running, err := c.stopRunningInstances()
+	if err != nil {
+		// start the VMs that did stop, and drop the state copied for the clone
+		return errors.Join(err, startInstances(running), DeleteState(newName))
+	}
+
+	var errs []error
+	var clonedVMs []string
+
+	for _, vmName := range vms {
+		// murphy-srv-01 -> murphy2-srv-01
+		newVMName := newName + strings.TrimPrefix(vmName, c.Name)
+
+		yqExpression := fmt.Sprintf(`.env.SHIKARI_CLUSTER_NAME="%s"`, newName)
+
+		provisionExpr, provisionEnv, err := state.provisionExpression(newVMName)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if provisionExpr != "" {
+			yqExpression = fmt.Sprintf("%s | %s", yqExpression, provisionExpr)
+		}
+
+		if err := lima.CloneLimaVM(vmName, newVMName, yqExpression, provisionEnv); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		clonedVMs = append(clonedVMs, newVMName)
+	}
+
+	if err := startInstances(running); err != nil {
+		errs = append(errs, err)
+	}
+
+	// only record the new cluster if any of its VMs exists
+	if len(clonedVMs) == 0 {
+		return errors.Join(append(errs, DeleteState(newName))...)
+	}
+
+	if err := state.Save(); err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	if start {
+		if err := startInstances(clonedVMs); err != nil {
+			errs = append(errs, err)
+		}
+
+		if err := clone.FinishProvisioning(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// prepareClone copies the state directory of the cluster for the cloned
+// cluster, as the VMs need its files, and returns the state of the cloned
+// cluster, to be saved once its VMs exist.
+func (c ShikariCluster) prepareClone(newName string) (ClusterState, error) {
+	state, err := LoadState(c.Name)
+	if err != nil {
+		return state, err
+	}
+
+	if err := copyStateDir(c.Name, newName); err != nil {
+		return state, err
+	}
+
+	state.Name = newName
+	state.ClonedFrom = c.Name
+	state.Faults = nil // the VMs are cloned while stopped, losing the faults
+	state.CreatedAt = time.Now()
+
+	return state, nil
+}
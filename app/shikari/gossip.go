@@ -0,0 +1,77 @@
+package shikari
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// setGossipKeys sets the Consul and Nomad gossip encryption keys of the
+// cluster, generating the ones that are not given.
+func (s *ClusterState) setGossipKeys(consulKey string, nomadKey string) error {
+	keys := map[string]*string{"consul": &consulKey, "nomad": &nomadKey}
+
+	for product, key := range keys {
+		if *key == "" {
+			generated, err := generateGossipKey()
+			if err != nil {
+				return err
+			}
+
+			*key = generated
+			continue
+		}
+
+		if err := validateGossipKey(*key); err != nil {
+			return fmt.Errorf("invalid %s gossip key: %w", product, err)
+		}
+	}
+
+	s.ConsulGossipKey = consulKey
+	s.NomadGossipKey = nomadKey
+
+	return nil
+}
+
+// gossipExpression returns the yq expression injecting the gossip keys of the
+// cluster. It is empty for clusters created without gossip keys in the state.
+func (s ClusterState) gossipExpression() string {
+	var envs []string
+
+	if s.ConsulGossipKey != "" {
+		envs = append(envs, fmt.Sprintf(`.env.SHIKARI_CONSUL_GOSSIP_KEY="%s"`, s.ConsulGossipKey))
+	}
+
+	if s.NomadGossipKey != "" {
+		envs = append(envs, fmt.Sprintf(`.env.SHIKARI_NOMAD_GOSSIP_KEY="%s"`, s.NomadGossipKey))
+	}
+
+	return strings.Join(envs, " | ")
+}
+
+// generateGossipKey returns a random 32 byte base64 encoded key, the same as
+// consul keygen and nomad operator gossip keyring generate
+func generateGossipKey() (string, error) {
+	key := make([]byte, 32)
+
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func validateGossipKey(key string) error {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("key must be base64 encoded: %w", err)
+	}
+
+	switch len(decoded) {
+	case 16, 24, 32:
+		return nil
+	}
+
+	return fmt.Errorf("key must be 16, 24 or 32 bytes long, got %d", len(decoded))
+}
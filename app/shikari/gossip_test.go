@@ -0,0 +1,48 @@
+package shikari
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestValidateGossipKey(t *testing.T) {
+	key := func(n int) string {
+		return base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", n)))
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{"16 bytes", key(16), false},
+		{"24 bytes", key(24), false},
+		{"32 bytes", key(32), false},
+		{"too short", key(8), true},
+		{"between sizes", key(20), true},
+		{"too long", key(64), true},
+		{"not base64", "not a key!", true},
+		{"url encoding", strings.NewReplacer("+", "-", "/", "_").Replace(base64.StdEncoding.EncodeToString([]byte(strings.Repeat("\xfb\xff", 16)))), true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateGossipKey(tt.key); (err != nil) != tt.wantErr {
+				t.Errorf("validateGossipKey(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateGossipKey(t *testing.T) {
+	key, err := generateGossipKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := validateGossipKey(key); err != nil {
+		t.Errorf("generated key %q is invalid: %v", key, err)
+	}
+}
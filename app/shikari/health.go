@@ -0,0 +1,134 @@
+package shikari
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+var ipv4Regex = regexp.MustCompile(`\b(\d{1,3}\.){3}\d{1,3}\b`)
+
+// healthProducts returns the definitions of the named products, all of which
+// must have an API endpoint reporting the leader.
+func healthProducts(names []string) ([]Product, error) {
+	products, err := LoadProducts()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []Product
+
+	for _, name := range names {
+		p, ok := products[name]
+		if !ok || p.LeaderPath == "" {
+			return nil, fmt.Errorf("health checks are not supported for product %q", name)
+		}
+
+		selected = append(selected, p)
+	}
+
+	return selected, nil
+}
+
+// leaderProducts returns the products with an API endpoint reporting the leader, sorted by name
+func leaderProducts() ([]Product, error) {
+	products, err := LoadProducts()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []Product
+
+	for _, p := range products {
+		if p.LeaderPath != "" {
+			selected = append(selected, p)
+		}
+	}
+
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Name < selected[j].Name })
+
+	return selected, nil
+}
+
+// IsHealthy reports whether the product running on the VM sees a leader, by
+// querying the API of the product from inside the VM.
+func IsHealthy(vmName string, p Product) bool {
+	output, err := lima.ExecLimaVMWithOutput(vmName, p.leaderCommand())
+	if err != nil {
+		return false
+	}
+
+	_, ok := parseLeader(output)
+
+	return ok
+}
+
+// parseLeader parses the response of the leader endpoint of a product: either
+// a JSON string with the address of the leader (eg: Consul and Nomad, empty
+// without a leader) or an object with a leader_address field (eg: Vault). It
+// returns the address of the leader, if known, and whether there is a leader.
+func parseLeader(output string) (string, bool) {
+	output = strings.TrimSpace(output)
+
+	var address string
+	if err := json.Unmarshal([]byte(output), &address); err == nil {
+		return address, address != ""
+	}
+
+	var status struct {
+		HAEnabled     *bool    `json:"ha_enabled"`
+		LeaderAddress string   `json:"leader_address"`
+		Errors        []string `json:"errors"`
+	}
+
+	if err := json.Unmarshal([]byte(output), &status); err != nil || len(status.Errors) > 0 {
+		return "", false
+	}
+
+	// without HA, the node answering is the only one and acts as the leader
+	if status.HAEnabled != nil && !*status.HAEnabled {
+		return status.LeaderAddress, true
+	}
+
+	return status.LeaderAddress, status.LeaderAddress != ""
+}
+
+// leaderCommand returns the command querying the leader endpoint of the product
+// from inside a VM. Plain HTTP is tried first and then TLS, as the scenario
+// decides which one is enabled, and error responses make the command fail.
+func (p Product) leaderCommand() string {
+	return fmt.Sprintf("curl -sfk --max-time 5 http://127.0.0.1:%d%s || curl -sfk --max-time 5 https://127.0.0.1:%d%s",
+		p.Port, p.LeaderPath, p.TLSPort, p.LeaderPath)
+}
+
+// healthyProducts returns the products that are healthy on the VM
+func healthyProducts(vmName string, products []Product) []Product {
+	return slices.DeleteFunc(slices.Clone(products), func(p Product) bool {
+		return !IsHealthy(vmName, p)
+	})
+}
+
+// WaitForHealth blocks until all the products are healthy on the VM or the timeout expires
+func WaitForHealth(vmName string, products []Product, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for _, p := range products {
+		for !IsHealthy(vmName, p) {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("timed out waiting for %s to become healthy on %s", p.Name, vmName)
+			}
+
+			time.Sleep(5 * time.Second)
+		}
+
+		fmt.Printf("%s is healthy on %s\n", p.Name, vmName)
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package shikari
+
+import "testing"
+
+func TestParseLeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		address string
+		ok      bool
+	}{
+		{"consul leader", `"192.168.105.2:8300"` + "\n", "192.168.105.2:8300", true},
+		{"consul no leader", `""`, "", false},
+		{"vault leader", `{"ha_enabled":true,"is_self":false,"leader_address":"https://192.168.105.3:8200"}`, "https://192.168.105.3:8200", true},
+		{"vault standby without leader", `{"ha_enabled":true,"leader_address":""}`, "", false},
+		{"vault without ha", `{"ha_enabled":false,"is_self":false,"leader_address":""}`, "", true},
+		{"vault sealed", `{"errors":["Vault is sealed"]}`, "", false},
+		{"not json", "curl: (7) Failed to connect", "", false},
+		{"empty", "", "", false},
+		{"ip in html", "<html>10.0.0.1</html>", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, ok := parseLeader(tt.output)
+			if address != tt.address || ok != tt.ok {
+				t.Errorf("parseLeader(%q) = %q, %t, want %q, %t", tt.output, address, ok, tt.address, tt.ok)
+			}
+		})
+	}
+}
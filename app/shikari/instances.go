@@ -0,0 +1,85 @@
+package shikari
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// stopRunningInstances stops the running VMs of the cluster concurrently and
+// returns their names, so that they can be started again afterwards.
+func (c ShikariCluster) stopRunningInstances() ([]string, error) {
+	var names []string
+
+	for _, vm := range lima.GetInstancesByStatus(lima.GetInstancesByPrefix(c.Name), "running") {
+		names = append(names, vm.Name)
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(names))
+
+	for _, vmName := range names {
+		wg.Add(1)
+		go lima.StopLimaVM(vmName, false, &wg, errCh)
+	}
+
+	wg.Wait()
+	close(errCh)
+
+	var errs []error
+	for err := range errCh {
+		errs = append(errs, err)
+	}
+
+	return names, errors.Join(errs...)
+}
+
+// startInstances starts the named VMs
+func startInstances(names []string) error {
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(names))
+
+	for _, vmName := range names {
+		wg.Add(1)
+
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			lima.StartLimaVM(vmName, &wg, errCh)
+		}()
+
+		// starting all the VMs at once is unreliable, so the next VM is only
+		// started once this one is up
+		waitUntilRunning(vmName, done)
+	}
+
+	wg.Wait()
+	close(errCh)
+
+	var errs []error
+	for err := range errCh {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// waitUntilRunning blocks until Lima reports the VM as running, or the start of the VM is done
+func waitUntilRunning(vmName string, done <-chan struct{}) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if lima.GetInstance(vmName).Status == "Running" {
+				return
+			}
+		}
+	}
+}
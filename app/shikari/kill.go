@@ -0,0 +1,213 @@
+package shikari
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// chaosLogFile is the file in the state directory of the cluster where the chaos actions are logged
+const chaosLogFile = "chaos.log"
+
+// KillOpts configures which VMs are killed and how
+type KillOpts struct {
+	Target       string        // selector of the VMs that can be killed
+	Count        int           // number of VMs killed at once
+	Force        bool          // force stop the VMs instead of shutting them down
+	RestartAfter time.Duration // start the VMs again after the delay, unless zero
+	Interval     time.Duration // kill VMs repeatedly at the interval, unless zero
+	Rounds       int           // number of repeated kills, zero meaning until interrupted
+}
+
+// Kill stops random running VMs matching the target, optionally starting them
+// again after a delay. With an interval, it keeps killing VMs until the rounds
+// are done or it is interrupted, never taking down more servers than the
+// cluster tolerates: (N-1)/2 for N servers. Every action is logged to the
+// standard output and to the chaos log of the cluster.
+func (c ShikariCluster) Kill(opts KillOpts) error {
+	if opts.Count < 1 {
+		return fmt.Errorf("the number of VMs to kill must be at least 1")
+	}
+
+	if opts.Interval > 0 && opts.RestartAfter == 0 {
+		return fmt.Errorf("repeated kills need a restart delay, so that the cluster recovers between them")
+	}
+
+	logger, logFile, err := c.chaosLogger()
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if opts.Interval == 0 {
+		return c.killRound(ctx, logger, opts, false)
+	}
+
+	logger.Printf("killing %d VM(s) matching %s every %s", opts.Count, opts.Target, opts.Interval)
+
+	for round := 1; opts.Rounds == 0 || round <= opts.Rounds; round++ {
+		logger.Printf("round %d", round)
+
+		if err := c.killRound(ctx, logger, opts, true); err != nil {
+			logger.Printf("round %d failed: %v", round, err)
+		}
+
+		if round == opts.Rounds {
+			break
+		}
+
+		if ctx.Err() != nil || !sleepContext(ctx, opts.Interval) {
+			logger.Printf("interrupted, stopping after round %d", round)
+			return nil
+		}
+	}
+
+	logger.Printf("done")
+
+	return nil
+}
+
+// killRound kills the VMs of a round and restarts them after the delay. The
+// VMs are restarted right away if interrupted while waiting.
+func (c ShikariCluster) killRound(ctx context.Context, logger *log.Logger, opts KillOpts, tolerate bool) error {
+	vms, err := c.SelectInstances(opts.Target)
+	if err != nil {
+		return err
+	}
+
+	candidates := lima.GetInstancesByStatus(vms, "running")
+
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	// servers that can still be taken down without losing the quorum
+	serverBudget := len(candidates)
+
+	if tolerate {
+		total, down := c.serverAvailability()
+		serverBudget = (total-1)/2 - down
+	}
+
+	var victims []string
+
+	for _, vm := range candidates {
+		if len(victims) == opts.Count {
+			break
+		}
+
+		if c.getInstanceMode(vm.Name) == "server" {
+			if serverBudget <= 0 {
+				continue
+			}
+			serverBudget--
+		}
+
+		victims = append(victims, vm.Name)
+	}
+
+	if len(victims) == 0 {
+		logger.Printf("no running VM matching %s can be killed", opts.Target)
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(victims))
+
+	for _, vmName := range victims {
+		logger.Printf("killing %s (force: %t)", vmName, opts.Force)
+
+		wg.Add(1)
+		go lima.StopLimaVM(vmName, opts.Force, &wg, errCh)
+	}
+
+	wg.Wait()
+	close(errCh)
+
+	var errs []error
+	for err := range errCh {
+		errs = append(errs, err)
+	}
+
+	// the faults of the VMs that went down are lost along with their state
+	var stopped []string
+
+	for _, vm := range lima.GetInstancesByPrefix(c.Name) {
+		if slices.Contains(victims, vm.Name) && strings.ToLower(vm.Status) != "running" {
+			stopped = append(stopped, vm.Name)
+		}
+	}
+
+	if err := c.forgetFaults(stopped); err != nil {
+		errs = append(errs, err)
+	}
+
+	if opts.RestartAfter == 0 {
+		return errors.Join(errs...)
+	}
+
+	logger.Printf("restarting %s in %s", strings.Join(victims, ","), opts.RestartAfter)
+
+	if !sleepContext(ctx, opts.RestartAfter) {
+		logger.Printf("interrupted, restarting %s now", strings.Join(victims, ","))
+	}
+
+	if err := startInstances(victims); err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+
+	logger.Printf("restarted %s", strings.Join(victims, ","))
+
+	return errors.Join(errs...)
+}
+
+// serverAvailability returns the number of servers of the cluster and how many of them are not running
+func (c ShikariCluster) serverAvailability() (int, int) {
+	servers := lima.GetInstancesByPrefix(fmt.Sprintf("%s-srv", c.Name))
+
+	return len(servers), len(servers) - len(lima.GetInstancesByStatus(servers, "running"))
+}
+
+// chaosLogger returns a logger writing to the standard output and to the chaos log of the cluster
+func (c ShikariCluster) chaosLogger() (*log.Logger, io.Closer, error) {
+	dir, err := StateDir(c.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, chaosLogFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return log.New(io.MultiWriter(os.Stdout, file), "", log.LstdFlags), file, nil
+}
+
+// sleepContext waits for the duration, returning false if the context is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,255 @@
+package shikari
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kubeConfig holds the parts of a kubeconfig file Shikari manages, keeping
+// everything else as-is.
+type kubeConfig struct {
+	APIVersion     string           `yaml:"apiVersion,omitempty"`
+	Kind           string           `yaml:"kind,omitempty"`
+	Clusters       []kubeNamedEntry `yaml:"clusters"`
+	Contexts       []kubeNamedEntry `yaml:"contexts"`
+	Users          []kubeNamedEntry `yaml:"users"`
+	CurrentContext string           `yaml:"current-context"`
+	Extra          map[string]any   `yaml:",inline"`
+}
+
+type kubeNamedEntry struct {
+	Name    string         `yaml:"name"`
+	Cluster map[string]any `yaml:"cluster,omitempty"`
+	Context map[string]any `yaml:"context,omitempty"`
+	User    map[string]any `yaml:"user,omitempty"`
+}
+
+// MergedKubeConfig records the entries merged into a kubeconfig of the user,
+// so that only those are removed again.
+type MergedKubeConfig struct {
+	Path string `json:"path"` // kubeconfig the entries were merged into
+	Name string `json:"name"` // name of the cluster, context and user
+}
+
+// KubeContextName returns the name of the cluster, context and user merged
+// into the kubeconfig of the user, eg: shikari-murphy
+func KubeContextName(clusterName string) string {
+	return "shikari-" + clusterName
+}
+
+// UserKubeConfigPath returns the path of the kubeconfig of the user, ie: the
+// first file in $KUBECONFIG, or ~/.kube/config when it is not set.
+func UserKubeConfigPath() (string, error) {
+	for _, path := range filepath.SplitList(os.Getenv("KUBECONFIG")) {
+		if path != "" {
+			return path, nil
+		}
+	}
+
+	homePath, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homePath, ".kube", "config"), nil
+}
+
+// MergeKubeConfig rewrites the k3s kubeconfig so that it reaches the API
+// server at serverIP, renames its cluster, context and user after the
+// cluster (see KubeContextName), and merges it into the kubeconfig of the
+// user, making it the current context. The merge is recorded in the state of
+// the cluster.
+func MergeKubeConfig(clusterName string, k3sKubeConfigPath string, serverIP string) error {
+	k3s, err := readKubeConfig(k3sKubeConfigPath)
+	if err != nil {
+		return err
+	}
+
+	if len(k3s.Clusters) != 1 || len(k3s.Contexts) != 1 || len(k3s.Users) != 1 {
+		return fmt.Errorf("expected a single cluster, context and user in %s", k3sKubeConfigPath)
+	}
+
+	name := KubeContextName(clusterName)
+
+	k3sCluster := k3s.Clusters[0]
+	k3sCluster.Name = name
+
+	if server, ok := k3sCluster.Cluster["server"].(string); ok {
+		// k3s writes the kubeconfig for use inside the VM, ie: https://127.0.0.1:6443
+		k3sCluster.Cluster["server"] = strings.Replace(server, "127.0.0.1", serverIP, 1)
+	}
+
+	k3sContext := k3s.Contexts[0]
+	k3sContext.Name = name
+	k3sContext.Context["cluster"] = name
+	k3sContext.Context["user"] = name
+
+	k3sUser := k3s.Users[0]
+	k3sUser.Name = name
+
+	state, err := LoadState(clusterName)
+	if err != nil {
+		return err
+	}
+
+	path, err := UserKubeConfigPath()
+	if err != nil {
+		return err
+	}
+
+	if path == k3sKubeConfigPath {
+		return fmt.Errorf("KUBECONFIG points at the k3s kubeconfig %s, unset it to merge into the kubeconfig of the user", path)
+	}
+
+	// entries merged earlier, possibly into another kubeconfig
+	if err := removeMergedKubeConfig(state.KubeConfig); err != nil {
+		return err
+	}
+
+	config, err := readKubeConfig(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		config = kubeConfig{APIVersion: "v1", Kind: "Config"}
+	} else if err != nil {
+		return err
+	}
+
+	if config.hasEntries(name) {
+		return fmt.Errorf("%s already has entries named %s not merged by Shikari", path, name)
+	}
+
+	config.Clusters = append(config.Clusters, k3sCluster)
+	config.Contexts = append(config.Contexts, k3sContext)
+	config.Users = append(config.Users, k3sUser)
+	config.CurrentContext = name
+
+	if err := writeKubeConfig(path, config); err != nil {
+		return err
+	}
+
+	state.KubeConfig = &MergedKubeConfig{Path: path, Name: name}
+
+	return state.Save()
+}
+
+// RemoveKubeConfig removes the cluster, context and user merged by
+// MergeKubeConfig from the kubeconfig of the user, if any.
+func RemoveKubeConfig(clusterName string) error {
+	state, err := LoadState(clusterName)
+	if err != nil {
+		return err
+	}
+
+	if state.KubeConfig == nil {
+		return nil
+	}
+
+	if err := removeMergedKubeConfig(state.KubeConfig); err != nil {
+		return err
+	}
+
+	state.KubeConfig = nil
+
+	return state.Save()
+}
+
+// removeMergedKubeConfig removes the merged entries from the kubeconfig they
+// were merged into, and unsets the current context if it is theirs.
+func removeMergedKubeConfig(merged *MergedKubeConfig) error {
+	if merged == nil {
+		return nil
+	}
+
+	config, err := readKubeConfig(merged.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !config.removeEntries(merged.Name) {
+		return nil
+	}
+
+	if config.CurrentContext == merged.Name {
+		config.CurrentContext = ""
+	}
+
+	return writeKubeConfig(merged.Path, config)
+}
+
+// hasEntries reports whether there is a cluster, context or user with the name
+func (k kubeConfig) hasEntries(name string) bool {
+	for _, entries := range [][]kubeNamedEntry{k.Clusters, k.Contexts, k.Users} {
+		for _, e := range entries {
+			if e.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// removeEntries removes the entries with the name and reports whether any was removed
+func (k *kubeConfig) removeEntries(name string) bool {
+	var removed bool
+
+	remove := func(entries []kubeNamedEntry) []kubeNamedEntry {
+		var kept []kubeNamedEntry
+
+		for _, e := range entries {
+			if e.Name == name {
+				removed = true
+				continue
+			}
+			kept = append(kept, e)
+		}
+
+		return kept
+	}
+
+	k.Clusters = remove(k.Clusters)
+	k.Contexts = remove(k.Contexts)
+	k.Users = remove(k.Users)
+
+	return removed
+}
+
+func readKubeConfig(path string) (kubeConfig, error) {
+	var config kubeConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("error parsing kubeconfig %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+func writeKubeConfig(path string, config kubeConfig) error {
+	var data bytes.Buffer
+
+	enc := yaml.NewEncoder(&data)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(config); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data.Bytes(), 0600)
+}
@@ -0,0 +1,173 @@
+package shikari
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testK3SKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: default
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: default
+  context:
+    cluster: default
+    user: default
+users:
+- name: default
+  user:
+    token: secret
+current-context: default
+`
+
+const testUserKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: murphy
+  cluster:
+    server: https://10.0.0.1:6443
+contexts:
+- name: murphy
+  context:
+    cluster: murphy
+    user: murphy
+users:
+- name: murphy
+  user:
+    token: other
+current-context: murphy
+preferences: {}
+`
+
+func entryNames(entries []kubeNamedEntry) []string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestMergeAndRemoveKubeConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		existing       string // kubeconfig of the user before the merge, if any
+		switchContext  bool   // whether the user switches to another context after the merge
+		wantNames      []string
+		wantContextEnd string // current context after the removal
+	}{
+		{"no kubeconfig", "", false, nil, ""},
+		{"entries named after the cluster are kept", testUserKubeConfig, false, []string{"murphy"}, ""},
+		{"current context of the user is kept", testUserKubeConfig, true, []string{"murphy"}, "murphy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+
+			userPath := filepath.Join(home, "kubeconfig")
+			t.Setenv("KUBECONFIG", userPath+string(os.PathListSeparator)+filepath.Join(home, "other"))
+
+			if tt.existing != "" {
+				if err := os.WriteFile(userPath, []byte(tt.existing), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			k3sPath := filepath.Join(home, "k3s.yaml")
+			if err := os.WriteFile(k3sPath, []byte(testK3SKubeConfig), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := MergeKubeConfig("murphy", k3sPath, "192.168.105.13"); err != nil {
+				t.Fatalf("MergeKubeConfig: %v", err)
+			}
+
+			config, err := readKubeConfig(userPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if config.CurrentContext != "shikari-murphy" {
+				t.Errorf("current context = %s, want shikari-murphy", config.CurrentContext)
+			}
+
+			merged := config.Clusters[len(config.Clusters)-1]
+			if merged.Name != "shikari-murphy" || merged.Cluster["server"] != "https://192.168.105.13:6443" {
+				t.Errorf("merged cluster = %+v", merged)
+			}
+
+			if tt.existing != "" && config.Extra["preferences"] == nil {
+				t.Error("unmanaged fields of the kubeconfig are lost")
+			}
+
+			state, err := LoadState("murphy")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if state.KubeConfig == nil || state.KubeConfig.Path != userPath || state.KubeConfig.Name != "shikari-murphy" {
+				t.Errorf("recorded merge = %+v", state.KubeConfig)
+			}
+
+			if tt.switchContext {
+				config.CurrentContext = "murphy"
+				if err := writeKubeConfig(userPath, config); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := RemoveKubeConfig("murphy"); err != nil {
+				t.Fatalf("RemoveKubeConfig: %v", err)
+			}
+
+			config, err = readKubeConfig(userPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, names := range [][]string{entryNames(config.Clusters), entryNames(config.Contexts), entryNames(config.Users)} {
+				if len(names) != len(tt.wantNames) || (len(names) > 0 && names[0] != tt.wantNames[0]) {
+					t.Errorf("entries left = %v, want %v", names, tt.wantNames)
+				}
+			}
+
+			if config.CurrentContext != tt.wantContextEnd {
+				t.Errorf("current context = %q, want %q", config.CurrentContext, tt.wantContextEnd)
+			}
+
+			if state, _ := LoadState("murphy"); state.KubeConfig != nil {
+				t.Errorf("merge still recorded after the removal: %+v", state.KubeConfig)
+			}
+		})
+	}
+}
+
+func TestRemoveKubeConfigWithoutMerge(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	userPath := filepath.Join(home, "kubeconfig")
+	t.Setenv("KUBECONFIG", userPath)
+
+	if err := os.WriteFile(userPath, []byte(testUserKubeConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RemoveKubeConfig("murphy"); err != nil {
+		t.Fatalf("RemoveKubeConfig: %v", err)
+	}
+
+	data, err := os.ReadFile(userPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != testUserKubeConfig {
+		t.Errorf("kubeconfig modified without a recorded merge:\n%s", data)
+	}
+}
@@ -0,0 +1,138 @@
+package shikari
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// Network faults only affect the lima0 interface, which carries the traffic
+// between the VMs, so that limactl keeps reaching the VMs over SSH.
+const chaosInterface = "lima0"
+
+// Partition drops the traffic between the VMs matching the two selectors of
+// sides (eg: zone-a and zone-b). VMs matching both sides are left out of the
+// second one, so srv-01 and all isolates srv-01 from the rest of the cluster.
+func (c ShikariCluster) Partition(sides []string) (Fault, error) {
+	if len(sides) != 2 {
+		return Fault{}, fmt.Errorf("partition needs exactly two sides, eg: --between zone-a,zone-b or --side zone-a --side zone-b")
+	}
+
+	left, err := c.runningTargets(sides[0])
+	if err != nil {
+		return Fault{}, err
+	}
+
+	right, err := c.runningTargets(sides[1])
+	if err != nil {
+		return Fault{}, err
+	}
+
+	right = slices.DeleteFunc(right, func(vm lima.LimaVM) bool {
+		return slices.ContainsFunc(left, func(l lima.LimaVM) bool { return l.Name == vm.Name })
+	})
+
+	if len(right) == 0 {
+		return Fault{}, fmt.Errorf("no VMs left on the %s side of the partition", sides[1])
+	}
+
+	state, err := LoadState(c.Name)
+	if err != nil {
+		return Fault{}, err
+	}
+
+	// every VM gets a chain of its own for the fault, dropping the traffic
+	// from and to the IP addresses of the other side
+	chain := "SHIKARI-" + strings.ToUpper(state.nextFaultID("partition"))
+
+	ips := make(map[string]string)
+
+	for _, vm := range append(slices.Clone(left), right...) {
+		if ips[vm.Name] = vm.GetIPAddress(); ips[vm.Name] == "" {
+			return Fault{}, fmt.Errorf("cannot find the %s IP address of VM %s", chaosInterface, vm.Name)
+		}
+	}
+
+	apply := make(map[string]string)
+	undo := make(map[string]string)
+
+	for _, pair := range [][2][]lima.LimaVM{{left, right}, {right, left}} {
+		for _, vm := range pair[0] {
+			commands := []string{"sudo iptables -N " + chain}
+
+			for _, peer := range pair[1] {
+				commands = append(commands,
+					fmt.Sprintf("sudo iptables -A %s -s %s -j DROP", chain, ips[peer.Name]),
+					fmt.Sprintf("sudo iptables -A %s -d %s -j DROP", chain, ips[peer.Name]))
+			}
+
+			commands = append(commands,
+				fmt.Sprintf("sudo iptables -I INPUT -i %s -j %s", chaosInterface, chain),
+				fmt.Sprintf("sudo iptables -I OUTPUT -o %s -j %s", chaosInterface, chain))
+
+			apply[vm.Name] = strings.Join(commands, " && ")
+			// each step is allowed to fail, as the rules are gone if the VM
+			// restarted, and the chain must be gone in the end
+			undo[vm.Name] = fmt.Sprintf("sudo iptables -D INPUT -i %[1]s -j %[2]s 2>/dev/null; sudo iptables -D OUTPUT -o %[1]s -j %[2]s 2>/dev/null; "+
+				"sudo iptables -F %[2]s 2>/dev/null; sudo iptables -X %[2]s 2>/dev/null; ! sudo iptables -n -L %[2]s >/dev/null 2>&1",
+				chaosInterface, chain)
+		}
+	}
+
+	return state.injectFault(Fault{Kind: "partition", Details: fmt.Sprintf("%s <-> %s", sides[0], sides[1]), Undo: undo}, apply)
+}
+
+// Latency delays the traffic sent by the VMs matching the selector
+func (c ShikariCluster) Latency(selector string, delay time.Duration, jitter time.Duration) (Fault, error) {
+	if delay < time.Millisecond || jitter < 0 {
+		return Fault{}, fmt.Errorf("the delay must be at least 1ms")
+	}
+
+	netem := fmt.Sprintf("delay %dms", delay.Milliseconds())
+	if jitter > 0 {
+		netem = fmt.Sprintf("%s %dms", netem, jitter.Milliseconds())
+	}
+
+	return c.netem("latency", selector, netem)
+}
+
+// Loss drops the given percentage of the packets sent by the VMs matching the selector
+func (c ShikariCluster) Loss(selector string, percent float64) (Fault, error) {
+	if percent <= 0 || percent > 100 {
+		return Fault{}, fmt.Errorf("the loss must be a percentage between 0 and 100")
+	}
+
+	return c.netem("loss", selector, fmt.Sprintf("loss %g%%", percent))
+}
+
+// netem applies the netem qdisc with the given parameters to the VMs matching
+// the selector. A VM can only have one of them at a time.
+func (c ShikariCluster) netem(kind string, selector string, params string) (Fault, error) {
+	vms, err := c.runningTargets(selector)
+	if err != nil {
+		return Fault{}, err
+	}
+
+	state, err := LoadState(c.Name)
+	if err != nil {
+		return Fault{}, err
+	}
+
+	apply := make(map[string]string)
+	undo := make(map[string]string)
+
+	for _, vm := range vms {
+		if f, ok := state.faultOf(vm, "latency", "loss"); ok {
+			return Fault{}, fmt.Errorf("VM %s already has fault %s (%s), heal it first", vm.Name, f.ID, f.Details)
+		}
+
+		apply[vm.Name] = fmt.Sprintf("sudo tc qdisc add dev %s root netem %s", chaosInterface, params)
+		// the qdisc is gone if the VM restarted, so only check that none is left
+		undo[vm.Name] = fmt.Sprintf("sudo tc qdisc del dev %[1]s root netem 2>/dev/null; ! tc qdisc show dev %[1]s | grep -q netem", chaosInterface)
+	}
+
+	return state.injectFault(Fault{Kind: kind, Details: fmt.Sprintf("%s on %s", params, selector), Undo: undo}, apply)
+}
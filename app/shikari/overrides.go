@@ -0,0 +1,67 @@
+package shikari
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// envOverrideRegex matches the per role and per node env overrides, eg: servers:DC=dc1 or srv-01:BOOTSTRAP=true
+var envOverrideRegex = regexp.MustCompile(`^(servers|clients|srv-(\d+)|cli-(\d+)):(.+)$`)
+
+// envOverride is an env var applied to all the VMs of a mode, or to the VM with index when not zero
+type envOverride struct {
+	mode  string
+	index int
+	env   string
+}
+
+// parseEnvOverrides parses the NodeEnvVars of the cluster
+func (c ShikariCluster) parseEnvOverrides() ([]envOverride, error) {
+	var overrides []envOverride
+
+	for _, e := range c.NodeEnvVars {
+		matches := envOverrideRegex.FindStringSubmatch(e)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid env override %q, expected <servers|clients|srv-NN|cli-NN>:KEY=VALUE", e)
+		}
+
+		o := envOverride{env: matches[4]}
+
+		switch {
+		case matches[1] == "servers":
+			o.mode = "server"
+		case matches[1] == "clients":
+			o.mode = "client"
+		case matches[2] != "":
+			o.mode = "server"
+			o.index, _ = strconv.Atoi(matches[2])
+		default:
+			o.mode = "client"
+			o.index, _ = strconv.Atoi(matches[3])
+		}
+
+		overrides = append(overrides, o)
+	}
+
+	return overrides, nil
+}
+
+// envVarsFor returns the user defined env vars of the VM: the ones of the
+// cluster, overridden by the ones of its role, overridden by its own
+func (c ShikariCluster) envVarsFor(vmName string, overrides []envOverride) []string {
+	envs := append([]string{}, c.EnvVars...)
+
+	mode := c.getInstanceMode(vmName)
+	index, _ := c.getInstanceIndex(vmName)
+
+	for _, node := range []bool{false, true} {
+		for _, o := range overrides {
+			if o.mode == mode && (o.index != 0) == node && (!node || o.index == index) {
+				envs = append(envs, o.env)
+			}
+		}
+	}
+
+	return MergeEnvVars(envs)
+}
@@ -0,0 +1,79 @@
+package shikari
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseEnvOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		node    []string
+		want    []envOverride
+		wantErr bool
+	}{
+		{"none", nil, nil, false},
+		{"roles", []string{"servers:A=1", "clients:B=2"}, []envOverride{{"server", 0, "A=1"}, {"client", 0, "B=2"}}, false},
+		{"nodes", []string{"srv-01:BOOTSTRAP=true", "cli-03:C=3"}, []envOverride{{"server", 1, "BOOTSTRAP=true"}, {"client", 3, "C=3"}}, false},
+		{"value with a colon", []string{"servers:URL=http://x:80"}, []envOverride{{"server", 0, "URL=http://x:80"}}, false},
+		{"unknown target", []string{"workers:A=1"}, nil, true},
+		{"missing target", []string{"A=1"}, nil, true},
+		{"missing env", []string{"servers:"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := ShikariCluster{Name: "murphy", NodeEnvVars: tt.node}
+
+			got, err := c.parseEnvOverrides()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEnvOverrides() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseEnvOverrides() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvVarsFor(t *testing.T) {
+	c := ShikariCluster{
+		Name:    "murphy",
+		EnvVars: []string{"DC=dc1", "ROLE=any", "DEBUG=false"},
+		NodeEnvVars: []string{
+			"srv-01:DEBUG=true", // before the role override, still winning over it
+			"servers:ROLE=server",
+			"servers:DEBUG=role",
+			"clients:ROLE=client",
+			"cli-02:EXTRA=1",
+		},
+	}
+
+	overrides, err := c.parseEnvOverrides()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		vmName string
+		want   []string
+	}{
+		{"murphy-srv-01", []string{"DC=dc1", "ROLE=server", "DEBUG=true"}},
+		{"murphy-srv-02", []string{"DC=dc1", "ROLE=server", "DEBUG=role"}},
+		{"murphy-cli-01", []string{"DC=dc1", "ROLE=client", "DEBUG=false"}},
+		{"murphy-cli-02", []string{"DC=dc1", "ROLE=client", "DEBUG=false", "EXTRA=1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.vmName, func(t *testing.T) {
+			if got := c.envVarsFor(tt.vmName, overrides); !slices.Equal(got, tt.want) {
+				t.Errorf("envVarsFor(%s) = %v, want %v", tt.vmName, got, tt.want)
+			}
+		})
+	}
+
+	if !slices.Equal(c.EnvVars, []string{"DC=dc1", "ROLE=any", "DEBUG=false"}) {
+		t.Errorf("envVarsFor modified the env vars of the cluster: %v", c.EnvVars)
+	}
+}
@@ -0,0 +1,288 @@
+package shikari
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// The CA of the host-side PKI of a cluster lives in the pki directory of its
+// state directory, in ca.pem and ca-key.pem. The certificate of every VM is
+// staged for its first boot (see provisionExpression) and installed into
+// PKIGuestDir, then re-issued with the lima0 IP address of the VM once it is
+// up (see finishProvisioning).
+const (
+	pkiDir      = "pki"
+	caKeyFile   = "ca-key.pem"
+	PKIGuestDir = "/etc/shikari/tls"
+
+	pkiValidity = 5 * 365 * 24 * time.Hour
+)
+
+// CACertPath returns the path of the CA certificate of the cluster
+func CACertPath(clusterName string) (string, error) {
+	dir, err := StateDir(clusterName)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, pkiDir, "ca.pem"), nil
+}
+
+// issueCertificate issues a certificate for the VM signed by the CA of the
+// cluster (creating the CA when missing), and writes ca.pem, cert.pem and
+// key.pem into certDir. The lima0 IP address of the VM is added to the
+// certificate when known.
+func issueCertificate(clusterName string, vmName string, certDir string, ip net.IP) error {
+	caCert, caKey, err := loadOrCreateCA(clusterName)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(certDir, 0700); err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	ips := []net.IP{net.ParseIP("127.0.0.1")}
+	if ip != nil {
+		ips = append(ips, ip)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: vmName},
+		DNSNames:     certificateDNSNames(clusterName, vmName),
+		IPAddresses:  ips,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(pkiValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(certDir, "ca.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw}), 0644); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(certDir, "cert.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(certDir, "key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+}
+
+// installCertificate re-issues the certificate of the running VM with its
+// lima0 IP address, installs it into PKIGuestDir and reloads the agents, so
+// that clients can verify the servers by their IP address.
+func (s ClusterState) installCertificate(vmName string) error {
+	ip := net.ParseIP(lima.GetInstance(vmName).GetIPAddress())
+	if ip == nil {
+		return fmt.Errorf("no lima0 IP address found for %s", vmName)
+	}
+
+	certDir, err := os.MkdirTemp("", fmt.Sprintf("%s-tls-*", vmName))
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(certDir)
+
+	if err := issueCertificate(s.Name, vmName, certDir, ip); err != nil {
+		return fmt.Errorf("error issuing the certificate of %s: %w", vmName, err)
+	}
+
+	out, err := lima.ExecLimaVMWithOutput(vmName, "mktemp -d")
+	if err != nil {
+		return err
+	}
+
+	guestDir := strings.TrimSpace(out)
+
+	for _, name := range []string{"cert.pem", "key.pem"} {
+		if err := lima.CopyToLimaVM(vmName, filepath.Join(certDir, name), path.Join(guestDir, name)); err != nil {
+			return err
+		}
+	}
+
+	products, _ := LoadProducts() // the built-in products on error
+
+	var units []string
+	for _, name := range ProductNames(products) {
+		units = append(units, lima.ShellQuote(name))
+	}
+
+	script := fmt.Sprintf(`sudo install -m 0644 %[1]s/cert.pem %[2]s/ && sudo install -m 0600 %[1]s/key.pem %[2]s/ && rm -rf %[1]s && `+
+		`for s in %[3]s; do if systemctl is-active --quiet "$s"; then sudo systemctl reload "$s" || true; fi; done`,
+		guestDir, PKIGuestDir, strings.Join(units, " "))
+
+	_, err = lima.ExecLimaVMWithOutput(vmName, script)
+
+	return err
+}
+
+// certificateDNSNames returns the names of the VM, along with the names the
+// products use to verify servers and clients. The lima0 IP address is not
+// known before the VM boots, hence clients verify the server name (eg:
+// CONSUL_TLS_SERVER_NAME) until the certificate is re-issued.
+func certificateDNSNames(clusterName string, vmName string) []string {
+	names := []string{vmName, "lima-" + vmName, "localhost"}
+
+	if (ShikariCluster{Name: clusterName}).getInstanceMode(vmName) == "client" {
+		return append(names,
+			fmt.Sprintf("client.%s.consul", clusterName), "client.dc1.consul",
+			"client.global.nomad",
+		)
+	}
+
+	return append(names,
+		fmt.Sprintf("server.%s.consul", clusterName), "server.dc1.consul", "consul.service.consul",
+		"server.global.nomad", "nomad.service.consul",
+		"vault.service.consul", "active.vault.service.consul",
+		"boundary.service.consul",
+	)
+}
+
+// caKeyMissing reports whether the cluster has a CA but not its key, eg: when
+// imported from an archive exported without the secrets
+func caKeyMissing(clusterName string) bool {
+	certPath, err := CACertPath(clusterName)
+	if err != nil {
+		return false
+	}
+
+	if _, err := os.Stat(certPath); err != nil {
+		return false
+	}
+
+	_, err = os.Stat(filepath.Join(filepath.Dir(certPath), caKeyFile))
+
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+func loadOrCreateCA(clusterName string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPath, err := CACertPath(clusterName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPath := filepath.Join(filepath.Dir(certPath), caKeyFile)
+
+	certPEM, err := os.ReadFile(certPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return createCA(clusterName, certPath, keyPath)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("the CA key of cluster %s is missing (eg: exported without --include-secrets), no certificates can be issued", clusterName)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("invalid CA of cluster %s", clusterName)
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+func createCA(clusterName string, certPath string, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: fmt.Sprintf("Shikari CA %s", clusterName)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(pkiValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certPath), 0700); err != nil {
+		return nil, nil, err
+	}
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, nil, err
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
@@ -0,0 +1,150 @@
+package shikari
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestIssueCertificate(t *testing.T) {
+	tests := []struct {
+		name    string
+		vmName  string
+		ip      net.IP
+		wantIPs []string
+		wantDNS string
+	}{
+		{"server before boot", "murphy-srv-01", nil, []string{"127.0.0.1"}, "server.murphy.consul"},
+		{"server with its lima0 IP", "murphy-srv-01", net.ParseIP("192.168.105.13"), []string{"127.0.0.1", "192.168.105.13"}, "server.global.nomad"},
+		{"client", "murphy-cli-01", net.ParseIP("192.168.105.14"), []string{"127.0.0.1", "192.168.105.14"}, "client.murphy.consul"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+
+			certDir := filepath.Join(t.TempDir(), "tls")
+
+			if err := issueCertificate("murphy", tt.vmName, certDir, tt.ip); err != nil {
+				t.Fatalf("issueCertificate: %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(certDir, "cert.pem"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			block, _ := pem.Decode(data)
+			if block == nil {
+				t.Fatal("cert.pem holds no PEM block")
+			}
+
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ips []string
+			for _, ip := range cert.IPAddresses {
+				ips = append(ips, ip.String())
+			}
+
+			if !slices.Equal(ips, tt.wantIPs) {
+				t.Errorf("IP SANs = %v, want %v", ips, tt.wantIPs)
+			}
+
+			if !slices.Contains(cert.DNSNames, tt.vmName) || !slices.Contains(cert.DNSNames, tt.wantDNS) {
+				t.Errorf("DNS SANs = %v, want %s and %s", cert.DNSNames, tt.vmName, tt.wantDNS)
+			}
+
+			caPath, err := CACertPath("murphy")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			caPEM, err := os.ReadFile(caPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			roots := x509.NewCertPool()
+			roots.AppendCertsFromPEM(caPEM)
+
+			if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: tt.wantDNS}); err != nil {
+				t.Errorf("certificate not verified by the CA of the cluster: %v", err)
+			}
+
+			info, err := os.Stat(filepath.Join(certDir, "key.pem"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("key.pem mode = %v, want 0600", info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestProvisionExpression(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	state := ClusterState{Name: "murphy"}
+
+	expr, env, err := state.provisionExpression("murphy-srv-01")
+	if err != nil || expr != "" || env != nil {
+		t.Errorf("provisionExpression() without PKI = %q, %v, %v, want nothing", expr, env, err)
+	}
+
+	state.PKI = true
+
+	expr, env, err = state.provisionExpression("murphy-srv-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := state.stagingDir("murphy-srv-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(env, []string{"SHIKARI_PATH_PROVISION=" + dir}) {
+		t.Errorf("provisionExpression() env = %v, want the staging directory %s", env, dir)
+	}
+
+	for _, want := range []string{`strenv(SHIKARI_PATH_PROVISION)`, provisionMountPoint, `.env.SHIKARI_TLS_DIR="/etc/shikari/tls"`} {
+		if !strings.Contains(expr, want) {
+			t.Errorf("provisionExpression() = %q, want it to contain %q", expr, want)
+		}
+	}
+
+	for _, name := range []string{"ca.pem", "cert.pem", "key.pem"} {
+		if _, err := os.Stat(filepath.Join(dir, "tls", name)); err != nil {
+			t.Errorf("%s not staged: %v", name, err)
+		}
+	}
+}
+
+func TestIsStagedFile(t *testing.T) {
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{"provision", true},
+		{filepath.Join("provision", "murphy-srv-01", "tls", "key.pem"), true},
+		{"provisioned", false},
+		{filepath.Join("pki", "ca.pem"), false},
+		{"chaos.log", false},
+	}
+
+	for _, tt := range tests {
+		if got := isStagedFile(tt.rel); got != tt.want {
+			t.Errorf("isStagedFile(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package shikari
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Product describes how the API of a product running in the cluster is
+// reached, and the environment variables its CLI reads. Products are defined
+// in the built-in definitions below, and in YAML files in ~/.shikari/products/
+// which add new products or override fields of the built-in ones by name.
+type Product struct {
+	Name          string       `yaml:"name"`
+	AddrVar       string       `yaml:"addr_var"`
+	Port          int          `yaml:"port"`
+	TLSPort       int          `yaml:"tls_port,omitempty"` // defaults to port
+	Token         ProductToken `yaml:"token,omitempty"`
+	CACertVar     string       `yaml:"cacert_var,omitempty"`
+	CAPath        string       `yaml:"ca_path,omitempty"`       // template, defaults to defaultCAPath
+	CAGuestPath   string       `yaml:"ca_guest_path,omitempty"` // template, defaults to defaultCAGuestPath
+	InsecureVar   string       `yaml:"insecure_var,omitempty"`
+	InsecureValue string       `yaml:"insecure_value,omitempty"` // defaults to "true"
+	LeaderPath    string       `yaml:"leader_path,omitempty"`    // API endpoint reporting the current leader
+
+	// Server name verified by the CLI with the host-side PKI, as the lima0 IP
+	// address is only added to the certificates once the VMs are up.
+	TLSServerNameVar string `yaml:"tls_server_name_var,omitempty"`
+	TLSServerName    string `yaml:"tls_server_name,omitempty"` // template
+}
+
+// ProductToken describes where the management token of a product comes from.
+// The token is read from the file at host_path, then from the first server,
+// from the file at guest_path or the output of guest_command, and value is
+// only used when none of them yields a token.
+type ProductToken struct {
+	Var          string `yaml:"var,omitempty"`
+	Value        string `yaml:"value,omitempty"`
+	HostPath     string `yaml:"host_path,omitempty"`     // template, eg: {{.StateDir}}/vault-root-token
+	GuestPath    string `yaml:"guest_path,omitempty"`    // defaults to defaultTokenGuestPath
+	GuestCommand string `yaml:"guest_command,omitempty"` // eg: sudo jq -r .token /etc/nomad.d/bootstrap.json
+}
+
+// defaultCAPath is where the scenarios copy the CA certificate from the guest
+const defaultCAPath = "{{.VMDir}}/copied-from-guest/{{.Product}}-agent-ca.pem"
+
+// defaultCAGuestPath is where the CA certificate is fetched from when the
+// scenario did not copy it to the host
+const defaultCAGuestPath = "/etc/{{.Product}}.d/tls/{{.Product}}-agent-ca.pem"
+
+// defaultTokenGuestPath is the well-known path scenarios write the management token of a product to
+const defaultTokenGuestPath = "/etc/shikari/tokens/%s"
+
+var builtinProducts = []Product{
+	{
+		Name:          "consul",
+		AddrVar:       "CONSUL_HTTP_ADDR",
+		Port:          8500,
+		TLSPort:       8501,
+		Token:         ProductToken{Var: "CONSUL_HTTP_TOKEN", Value: "root"},
+		CACertVar:     "CONSUL_CACERT",
+		InsecureVar:   "CONSUL_HTTP_SSL_VERIFY",
+		InsecureValue: "false",
+		LeaderPath:    "/v1/status/leader",
+
+		TLSServerNameVar: "CONSUL_TLS_SERVER_NAME",
+		TLSServerName:    "server.{{.Cluster}}.consul",
+	},
+	{
+		Name:        "nomad",
+		AddrVar:     "NOMAD_ADDR",
+		Port:        4646,
+		Token:       ProductToken{Var: "NOMAD_TOKEN", Value: "00000000-0000-0000-0000-000000000000"},
+		CACertVar:   "NOMAD_CACERT",
+		InsecureVar: "NOMAD_SKIP_VERIFY",
+		LeaderPath:  "/v1/status/leader",
+
+		TLSServerNameVar: "NOMAD_TLS_SERVER_NAME",
+		TLSServerName:    "server.global.nomad",
+	},
+	{
+		Name:        "vault",
+		AddrVar:     "VAULT_ADDR",
+		Port:        8200,
+		Token:       ProductToken{Var: "VAULT_TOKEN", HostPath: "{{.StateDir}}/" + VaultRootTokenFile},
+		CACertVar:   "VAULT_CACERT",
+		InsecureVar: "VAULT_SKIP_VERIFY",
+		LeaderPath:  "/v1/sys/leader",
+
+		TLSServerNameVar: "VAULT_TLS_SERVER_NAME",
+		TLSServerName:    "vault.service.consul",
+	},
+	{
+		// ref: https://developer.hashicorp.com/boundary/docs/commands#environment-variables
+		Name:        "boundary",
+		AddrVar:     "BOUNDARY_ADDR",
+		Port:        9200,
+		CACertVar:   "BOUNDARY_CACERT",
+		InsecureVar: "BOUNDARY_TLS_INSECURE",
+
+		TLSServerNameVar: "BOUNDARY_TLS_SERVER_NAME",
+		TLSServerName:    "boundary.service.consul",
+	},
+}
+
+// productTemplateData is what the templated fields of a product can refer to
+type productTemplateData struct {
+	Cluster  string
+	Product  string
+	VMDir    string
+	StateDir string
+}
+
+// LoadProducts returns the built-in products along with the ones defined by
+// the user in ~/.shikari/products/*.yaml, keyed by name.
+func LoadProducts() (map[string]Product, error) {
+	products := make(map[string]Product)
+
+	for _, p := range builtinProducts {
+		products[p.Name] = p.withDefaults()
+	}
+
+	homePath, err := os.UserHomeDir()
+	if err != nil {
+		return products, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(homePath, ".shikari", "products", "*.y*ml"))
+	if err != nil {
+		return products, err
+	}
+
+	for _, file := range files {
+		p, err := loadProduct(file, builtinProducts)
+		if err != nil {
+			return products, err
+		}
+
+		products[p.Name] = p.withDefaults()
+	}
+
+	return products, nil
+}
+
+// ProductNames returns the sorted names of the products
+func ProductNames(products map[string]Product) []string {
+	var names []string
+
+	for name := range products {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// loadProduct reads the product definition at path. A definition named after
+// one of the built-in products only overrides the fields it sets.
+func loadProduct(path string, builtins []Product) (Product, error) {
+	var p Product
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("error parsing product definition %s: %w", path, err)
+	}
+
+	for _, builtin := range builtins {
+		if builtin.Name != p.Name {
+			continue
+		}
+
+		// decoding into the built-in product keeps the fields missing from the file
+		p = builtin
+
+		if err := yaml.Unmarshal(data, &p); err != nil {
+			return p, fmt.Errorf("error parsing product definition %s: %w", path, err)
+		}
+	}
+
+	if p.Name == "" || p.AddrVar == "" || p.Port == 0 {
+		return p, fmt.Errorf("product definition %s must have a name, addr_var and port", path)
+	}
+
+	if strings.ContainsAny(p.Name, ", ") {
+		return p, fmt.Errorf("product name %q in %s cannot contain commas or spaces", p.Name, path)
+	}
+
+	return p, nil
+}
+
+func (p Product) withDefaults() Product {
+	if p.TLSPort == 0 {
+		p.TLSPort = p.Port
+	}
+
+	if p.CAPath == "" {
+		p.CAPath = defaultCAPath
+	}
+
+	if p.CAGuestPath == "" {
+		p.CAGuestPath = defaultCAGuestPath
+	}
+
+	if p.Token.Var != "" && p.Token.GuestPath == "" {
+		p.Token.GuestPath = fmt.Sprintf(defaultTokenGuestPath, p.Name)
+	}
+
+	if p.InsecureValue == "" {
+		p.InsecureValue = "true"
+	}
+
+	return p
+}
+
+// RenderCAPath returns the CA certificate path of the product for the cluster and the VM directory
+func (p Product) RenderCAPath(clusterName string, vmDir string) (string, error) {
+	return p.render("ca_path", p.CAPath, clusterName, vmDir)
+}
+
+// RenderTokenHostPath returns the path of the file on the host holding the token of the product
+func (p Product) RenderTokenHostPath(clusterName string, vmDir string) (string, error) {
+	return p.render("token.host_path", p.Token.HostPath, clusterName, vmDir)
+}
+
+// RenderTLSServerName returns the server name the CLI of the product verifies with the host-side PKI
+func (p Product) RenderTLSServerName(clusterName string) (string, error) {
+	return p.render("tls_server_name", p.TLSServerName, clusterName, "")
+}
+
+// RenderCAGuestPath returns the path of the CA certificate of the product inside the VMs
+func (p Product) RenderCAGuestPath(clusterName string, vmDir string) (string, error) {
+	return p.render("ca_guest_path", p.CAGuestPath, clusterName, vmDir)
+}
+
+func (p Product) render(field string, text string, clusterName string, vmDir string) (string, error) {
+	tmpl, err := template.New(p.Name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s of product %s: %w", field, p.Name, err)
+	}
+
+	var out bytes.Buffer
+
+	stateDir, err := StateDir(clusterName)
+	if err != nil {
+		return "", err
+	}
+
+	data := productTemplateData{Cluster: clusterName, Product: p.Name, VMDir: vmDir, StateDir: stateDir}
+
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("invalid %s of product %s: %w", field, p.Name, err)
+	}
+
+	return out.String(), nil
+}
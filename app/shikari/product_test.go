@@ -0,0 +1,73 @@
+package shikari
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadProduct(t *testing.T) {
+	builtins := []Product{
+		{
+			Name:    "consul",
+			AddrVar: "CONSUL_HTTP_ADDR",
+			Port:    8500,
+			TLSPort: 8501,
+			Token:   ProductToken{Var: "CONSUL_HTTP_TOKEN", Value: "root"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		yaml    string
+		want    Product
+		wantErr bool
+	}{
+		{
+			name: "new product",
+			yaml: "name: waypoint\naddr_var: WAYPOINT_ADDR\nport: 9701\n",
+			want: Product{Name: "waypoint", AddrVar: "WAYPOINT_ADDR", Port: 9701},
+		},
+		{
+			name: "override of a built-in field",
+			yaml: "name: consul\nport: 18500\n",
+			want: Product{Name: "consul", AddrVar: "CONSUL_HTTP_ADDR", Port: 18500, TLSPort: 8501,
+				Token: ProductToken{Var: "CONSUL_HTTP_TOKEN", Value: "root"}},
+		},
+		{
+			name: "override of a nested built-in field",
+			yaml: "name: consul\ntoken:\n  value: secret\n",
+			want: Product{Name: "consul", AddrVar: "CONSUL_HTTP_ADDR", Port: 8500, TLSPort: 8501,
+				Token: ProductToken{Var: "CONSUL_HTTP_TOKEN", Value: "secret"}},
+		},
+		{
+			name:    "new product without a port",
+			yaml:    "name: waypoint\naddr_var: WAYPOINT_ADDR\n",
+			wantErr: true,
+		},
+		{
+			name:    "name with a comma",
+			yaml:    "name: a,b\naddr_var: A_ADDR\nport: 1\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "product.yaml")
+
+			if err := os.WriteFile(path, []byte(tt.yaml), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := loadProduct(path, builtins)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadProduct() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("loadProduct() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
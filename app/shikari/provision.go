@@ -0,0 +1,167 @@
+package shikari
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// Files delivered to a VM at its first boot, its certificate and secrets, are
+// staged in a directory per VM in the provision directory of the cluster
+// state, which is mounted read-only into the VM at provisionMountPoint. A
+// provisioning script, running before the ones of the template, installs them
+// into their place. Once the VM is up, the staging directory is emptied and
+// unmounted, so that the files are not left exposed to the users of the VM.
+const (
+	provisionDir        = "provision"
+	provisionMountPoint = "/mnt/shikari-provision"
+)
+
+// provisionInstallScript installs the staged files, the key and the secrets readable only by root
+var provisionInstallScript = strings.Join([]string{
+	"#!/bin/sh",
+	"set -eu",
+	"if [ -f " + provisionMountPoint + "/tls/cert.pem ]; then",
+	"  install -d -m 0755 " + PKIGuestDir,
+	"  install -m 0644 " + provisionMountPoint + "/tls/ca.pem " + provisionMountPoint + "/tls/cert.pem " + PKIGuestDir + "/",
+	"  install -m 0600 " + provisionMountPoint + "/tls/key.pem " + PKIGuestDir + "/",
+	"fi",
+	"if [ -d " + provisionMountPoint + "/" + secretsDir + " ]; then",
+	"  install -d -m 0700 " + SecretsGuestDir,
+	"  for f in " + provisionMountPoint + "/" + secretsDir + "/*; do",
+	`    if [ -f \"$f\" ]; then install -m 0600 \"$f\" ` + SecretsGuestDir + "/; fi",
+	"  done",
+	"fi",
+}, `\n`)
+
+// isStagedFile reports whether the path relative to the state directory is in the provision directory
+func isStagedFile(rel string) bool {
+	return rel == provisionDir || strings.HasPrefix(rel, provisionDir+string(filepath.Separator))
+}
+
+// stagingDir returns the directory the files delivered to the VM are staged in
+func (s ClusterState) stagingDir(vmName string) (string, error) {
+	dir, err := StateDir(s.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, provisionDir, vmName), nil
+}
+
+// provisionExpression stages the files delivered to the VM at its first boot
+// and returns the yq expression mounting them into the VM and installing
+// them, along with the environment of limactl it reads the staging directory
+// from. It is empty when there is nothing to deliver.
+func (s ClusterState) provisionExpression(vmName string) (string, []string, error) {
+	dir, err := s.stagingDir(vmName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// drop the files staged for an earlier VM of the same name
+	if err := os.RemoveAll(dir); err != nil {
+		return "", nil, err
+	}
+
+	var envs []string
+
+	// without the CA key, the VM keeps the certificate already on its disk
+	if s.PKI && !caKeyMissing(s.Name) {
+		if err := issueCertificate(s.Name, vmName, filepath.Join(dir, "tls"), nil); err != nil {
+			return "", nil, fmt.Errorf("error issuing the certificate of %s: %w", vmName, err)
+		}
+
+		envs = append(envs, fmt.Sprintf(`.env.SHIKARI_TLS_DIR="%s"`, PKIGuestDir))
+	}
+
+	secretEnvs, err := s.stageSecrets(dir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	envs = append(envs, secretEnvs...)
+
+	if len(envs) == 0 {
+		return "", nil, nil
+	}
+
+	// drop the mount of an earlier VM (eg: the one cloned) before adding this one
+	mount := fmt.Sprintf(`.mounts = ((.mounts // []) | map(select(.mountPoint != "%s"))) + [{"location": strenv(%sPROVISION), "mountPoint": "%s", "writable": false}]`,
+		provisionMountPoint, pathEnvPrefix, provisionMountPoint)
+
+	provision := fmt.Sprintf(`.provision = [{"mode": "system", "script": "%s"}] + (.provision // [])`, provisionInstallScript)
+
+	return strings.Join(append([]string{mount, provision}, envs...), " | "), []string{pathEnvPrefix + "PROVISION=" + dir}, nil
+}
+
+// finishProvisioning completes the delivery of the files staged for the
+// running VM: the certificate is re-issued with the lima0 IP address of the
+// VM, and the staged files are removed from the host and unmounted from the
+// VM. It does nothing when no files are staged.
+func (s ClusterState) finishProvisioning(vmName string) error {
+	dir, err := s.stagingDir(vmName)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	if s.PKI && !caKeyMissing(s.Name) {
+		if err := s.installCertificate(vmName); err != nil {
+			return err
+		}
+	}
+
+	// the mount stays in the configuration of the VM, hence the empty directory is kept
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	_, err = lima.ExecLimaVMWithOutput(vmName, fmt.Sprintf("sudo umount %s || true", provisionMountPoint))
+
+	return err
+}
+
+// FinishProvisioning completes the provisioning of the running VMs of the
+// cluster with files still staged for them, eg: after they were created or
+// started for the first time.
+func (c ShikariCluster) FinishProvisioning() error {
+	state, err := LoadState(c.Name)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, vm := range lima.GetInstancesByPrefix(c.Name) {
+		if _, ok := c.getInstanceIndex(vm.Name); !ok || vm.Status != "Running" {
+			continue
+		}
+
+		if err := state.finishProvisioning(vm.Name); err != nil {
+			errs = append(errs, fmt.Errorf("error finishing the provisioning of %s: %w", vm.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,150 @@
+package shikari
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// proxy forwards the connections accepted on the host to the servers of the
+// cluster in a round-robin fashion, skipping the servers that do not accept
+// the connection.
+type proxy struct {
+	cluster ShikariCluster
+
+	mu       sync.RWMutex
+	backends []string // lima0 IP addresses of the running servers
+
+	counter atomic.Uint64
+}
+
+// RunProxy listens on the ports on the bind address and forwards the
+// connections to the same ports on the running servers of the cluster. The
+// servers are looked up again every refresh interval, so that stopped or
+// replaced servers are picked up. It blocks until interrupted.
+func (c ShikariCluster) RunProxy(bind string, ports []int, refresh time.Duration) error {
+	p := &proxy{cluster: c}
+	p.refreshBackends()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var listeners []net.Listener
+
+	for _, port := range ports {
+		ln, err := net.Listen("tcp", net.JoinHostPort(bind, strconv.Itoa(port)))
+		if err != nil {
+			fmt.Printf("Error listening on port %d: %v\n", port, err)
+			continue
+		}
+
+		fmt.Printf("Proxying %s to the servers of cluster %s\n", ln.Addr(), c.Name)
+
+		listeners = append(listeners, ln)
+		go p.serve(ln, port)
+	}
+
+	if len(listeners) == 0 {
+		return fmt.Errorf("could not listen on any of the ports")
+	}
+
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return nil
+		case <-ticker.C:
+			p.refreshBackends()
+		}
+	}
+}
+
+func (p *proxy) refreshBackends() {
+	var backends []string
+
+	instances := lima.GetInstancesByPrefix(fmt.Sprintf("%s-srv", p.cluster.Name))
+
+	for _, vm := range lima.GetInstancesByStatus(instances, "running") {
+		if ip := vm.GetIPAddress(); ip != "" {
+			backends = append(backends, ip)
+		}
+	}
+
+	if len(backends) == 0 {
+		fmt.Printf("No running servers in the cluster %s\n", p.cluster.Name)
+	}
+
+	p.mu.Lock()
+	p.backends = backends
+	p.mu.Unlock()
+}
+
+func (p *proxy) serve(ln net.Listener, port int) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return // listener closed
+		}
+
+		go p.forward(conn, port)
+	}
+}
+
+func (p *proxy) forward(conn net.Conn, port int) {
+	defer conn.Close()
+
+	p.mu.RLock()
+	backends := p.backends
+	p.mu.RUnlock()
+
+	start := int(p.counter.Add(1))
+
+	for i := range len(backends) {
+		addr := net.JoinHostPort(backends[(start+i)%len(backends)], strconv.Itoa(port))
+
+		upstream, err := net.DialTimeout("tcp", addr, 2*time.Second)
+		if err != nil {
+			continue // try the next server
+		}
+		defer upstream.Close()
+
+		pipe(conn, upstream)
+		return
+	}
+
+	fmt.Printf("No healthy server to forward the connection on port %d to\n", port)
+}
+
+// pipe copies the data in both directions until both sides are done
+func pipe(a net.Conn, b net.Conn) {
+	var wg sync.WaitGroup
+
+	copyAndClose := func(dst net.Conn, src net.Conn) {
+		defer wg.Done()
+
+		io.Copy(dst, src)
+
+		if tcp, ok := dst.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+	}
+
+	wg.Add(2)
+	go copyAndClose(a, b)
+	go copyAndClose(b, a)
+	wg.Wait()
+}
@@ -0,0 +1,143 @@
+package shikari
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+type RolloutOpts struct {
+	Restart  bool          // restart the VMs instead of replacing them
+	Products []string      // products to wait for between the steps, besides the detected ones
+	Timeout  time.Duration // how long to wait for the products on each VM
+}
+
+// Rollout replaces (or restarts) the VMs of the cluster one at a time, servers
+// first and then clients, waiting for the products to become healthy before
+// moving on to the next VM. It stops at the first failure.
+//
+// The products gating each step are the ones reporting a leader on the VM
+// before it is touched, along with the ones in opts.Products. For a VM that
+// is not running, the products detected on the previous VM of its kind are used.
+func (c ShikariCluster) Rollout(opts RolloutOpts) error {
+	required, err := healthProducts(opts.Products)
+	if err != nil {
+		return err
+	}
+
+	candidates, err := leaderProducts()
+	if err != nil {
+		return err
+	}
+
+	var imageArg string
+	var imageEnv []string
+
+	if !opts.Restart && len(c.ImgPath) > 0 {
+		imageArg, imageEnv, err = imageExpression(c.ImgPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	vms := c.generateInstanceNames("server", c.getInstanceIndexes("server"))
+	vms = append(vms, c.generateInstanceNames("client", c.getInstanceIndexes("client"))...)
+
+	if len(vms) == 0 {
+		return fmt.Errorf("no instances in the cluster %s", c.Name)
+	}
+
+	// products detected on the previous VM of each kind
+	detected := make(map[string][]Product)
+
+	for i, vmName := range vms {
+		mode := c.getInstanceMode(vmName)
+
+		if lima.GetInstance(vmName).Status == "Running" {
+			detected[mode] = healthyProducts(vmName, candidates)
+		}
+
+		products := slices.Clone(required)
+		for _, p := range detected[mode] {
+			if !slices.ContainsFunc(products, func(r Product) bool { return r.Name == p.Name }) {
+				products = append(products, p)
+			}
+		}
+
+		fmt.Printf("\nRolling out %s (%d/%d), waiting for: %s\n\n", vmName, i+1, len(vms), joinProductNames(products))
+
+		var err error
+
+		if opts.Restart {
+			err = restartInstance(vmName)
+		} else {
+			err = c.ReplaceInstance(vmName, imageArg, imageEnv)
+		}
+
+		if err != nil {
+			return fmt.Errorf("rollout stopped at %s: %w", vmName, err)
+		}
+
+		if err := WaitForHealth(vmName, products, opts.Timeout); err != nil {
+			return fmt.Errorf("rollout stopped at %s: %w", vmName, err)
+		}
+	}
+
+	if imageArg == "" {
+		return nil
+	}
+
+	// every VM runs the new image, which scale uses from now on
+	state, err := LoadState(c.Name)
+	if err != nil {
+		return err
+	}
+
+	if state.Image, err = filepath.Abs(c.ImgPath); err != nil {
+		return err
+	}
+
+	return state.Save()
+}
+
+func restartInstance(vmName string) error {
+	var wg sync.WaitGroup
+	errCh := make(chan error, 1)
+
+	if lima.GetInstance(vmName).Status == "Running" {
+		wg.Add(1)
+		lima.StopLimaVM(vmName, false, &wg, errCh)
+
+		if len(errCh) > 0 {
+			return <-errCh
+		}
+	}
+
+	wg.Add(1)
+	lima.StartLimaVM(vmName, &wg, errCh)
+
+	if len(errCh) > 0 {
+		return <-errCh
+	}
+
+	return nil
+}
+
+// joinProductNames returns the comma separated names of the products, or none
+func joinProductNames(products []Product) string {
+	if len(products) == 0 {
+		return "none"
+	}
+
+	var names []string
+	for _, p := range products {
+		names = append(names, p.Name)
+	}
+
+	return strings.Join(names, ",")
+}
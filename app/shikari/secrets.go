@@ -0,0 +1,104 @@
+package shikari
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Secrets are written into the secrets directory of the cluster state, and
+// staged for the first boot of every VM (see provisionExpression), which
+// installs them into SecretsGuestDir readable only by root. Only their paths
+// are exposed to the VMs as <KEY>_PATH environment variables.
+const (
+	secretsDir      = "secrets"
+	SecretsGuestDir = "/etc/shikari/secrets"
+)
+
+// writeSecrets writes the secrets (in the KEY=VALUE form) into the secrets directory of the cluster
+func (c ShikariCluster) writeSecrets() error {
+	if len(c.Secrets) == 0 {
+		return nil
+	}
+
+	dir, err := StateDir(c.Name)
+	if err != nil {
+		return err
+	}
+
+	dir = filepath.Join(dir, secretsDir)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	for _, secret := range c.Secrets {
+		kv := strings.SplitN(secret, "=", 2)
+
+		if len(kv) != 2 || kv[1] == "" {
+			return fmt.Errorf("invalid secret format, expected KEY=VALUE")
+		}
+
+		if !envKeyRegex.MatchString(kv[0]) {
+			return fmt.Errorf("invalid secret name %q, must be a valid environment variable name", kv[0])
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, kv[0]), []byte(kv[1]), 0600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stageSecrets copies the secrets of the cluster into the staging directory
+// and returns the yq expressions exposing their paths. The names are checked
+// again, as secrets can also come from an imported archive.
+func (s ClusterState) stageSecrets(stagingDir string) ([]string, error) {
+	stateDir, err := StateDir(s.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(stateDir, secretsDir)
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var envs []string
+
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+
+		if !envKeyRegex.MatchString(e.Name()) {
+			return nil, fmt.Errorf("invalid secret name %q in %s, must be a valid environment variable name", e.Name(), dir)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := os.MkdirAll(filepath.Join(stagingDir, secretsDir), 0700); err != nil {
+			return nil, err
+		}
+
+		if err := os.WriteFile(filepath.Join(stagingDir, secretsDir, e.Name()), data, 0600); err != nil {
+			return nil, err
+		}
+
+		envs = append(envs, fmt.Sprintf(`.env.%s_PATH="%s/%s"`, e.Name(), SecretsGuestDir, e.Name()))
+	}
+
+	return envs, nil
+}
@@ -0,0 +1,70 @@
+package shikari
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestStageSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string // secret files of the cluster
+		want    []string
+		wantErr bool
+	}{
+		{"no secrets", nil, nil, false},
+		{"secrets", []string{"CONSUL_LICENSE", "NOMAD_LICENSE"}, []string{
+			`.env.CONSUL_LICENSE_PATH="/etc/shikari/secrets/CONSUL_LICENSE"`,
+			`.env.NOMAD_LICENSE_PATH="/etc/shikari/secrets/NOMAD_LICENSE"`,
+		}, false},
+		{"invalid name from an archive", []string{`X"|.provision=1`}, nil, true},
+		{"name starting with a digit", []string{"1KEY"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+
+			state := ClusterState{Name: "murphy"}
+
+			stateDir, err := StateDir(state.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, name := range tt.files {
+				if err := os.MkdirAll(filepath.Join(stateDir, secretsDir), 0700); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.WriteFile(filepath.Join(stateDir, secretsDir, name), []byte("value of "+name), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			stagingDir := t.TempDir()
+
+			got, err := state.stageSecrets(stagingDir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("stageSecrets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("stageSecrets() = %v, want %v", got, tt.want)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			for _, name := range tt.files {
+				data, err := os.ReadFile(filepath.Join(stagingDir, secretsDir, name))
+				if err != nil || string(data) != "value of "+name {
+					t.Errorf("staged %s = %q, %v", name, data, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package shikari
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+var instanceSuffixRegex = regexp.MustCompile(`^(srv|cli)-\d+$`)
+
+// isInstanceSuffix reports whether name is the part of a VM name following the cluster name, eg: srv-01
+func isInstanceSuffix(name string) bool {
+	return instanceSuffixRegex.MatchString(name)
+}
+
+// SelectInstances returns the VMs of the cluster matching the selector, a
+// comma separated list of terms, each one of: all, servers, clients, a zone,
+// a rack or a VM (eg: srv-01 or murphy-srv-01). Every term must match a VM.
+func (c ShikariCluster) SelectInstances(selector string) ([]lima.LimaVM, error) {
+	instances := lima.GetInstancesByPrefix(c.Name)
+
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("cluster %s does not exist", c.Name)
+	}
+
+	selected := make(map[string]bool)
+
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+
+		var matched bool
+
+		for _, vm := range instances {
+			if c.matchesTerm(vm, term) {
+				selected[vm.Name] = true
+				matched = true
+			}
+		}
+
+		if !matched {
+			return nil, fmt.Errorf("no VM of cluster %s matches %q", c.Name, term)
+		}
+	}
+
+	var vms []lima.LimaVM
+
+	for _, vm := range instances {
+		if selected[vm.Name] {
+			vms = append(vms, vm)
+		}
+	}
+
+	return vms, nil
+}
+
+func (c ShikariCluster) matchesTerm(vm lima.LimaVM, term string) bool {
+	switch term {
+	case "all":
+		return true
+	case "servers":
+		return c.getInstanceMode(vm.Name) == "server"
+	case "clients":
+		return c.getInstanceMode(vm.Name) == "client"
+	}
+
+	if vm.Name == term || vm.Name == fmt.Sprintf("%s-%s", c.Name, term) {
+		return true
+	}
+
+	return slices.Contains([]string{vm.GetZoneFromEnv(), vm.GetRackFromEnv()}, term) && term != ""
+}
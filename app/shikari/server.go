@@ -0,0 +1,131 @@
+package shikari
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// Strategies to select a server of the cluster. Any other value is taken as
+// the name of an instance, eg: srv-02 or murphy-srv-02.
+const (
+	ServerLeader = "leader"
+	ServerFirst  = "first"
+	ServerRandom = "random"
+)
+
+// SelectServer returns a running server of the cluster according to the
+// strategy. The leader is discovered by querying the API of the product from
+// inside the servers, and the first server is used when there is no leader.
+func (c ShikariCluster) SelectServer(strategy string, p *Product) (lima.LimaVM, error) {
+	// always get the instances of type server "-srv"
+	instances := lima.GetInstancesByPrefix(fmt.Sprintf("%s-srv", c.Name))
+	runningInstances := lima.GetInstancesByStatus(instances, "running")
+
+	if !(len(runningInstances) > 0) {
+		return lima.LimaVM{}, fmt.Errorf("no running servers in the cluster %s", c.Name)
+	}
+
+	switch strategy {
+	case ServerFirst:
+		return runningInstances[0], nil
+	case ServerRandom:
+		return runningInstances[rand.Intn(len(runningInstances))], nil
+	case ServerLeader:
+		if p == nil || p.LeaderPath == "" {
+			return runningInstances[0], nil
+		}
+
+		leader, err := findLeader(runningInstances, *p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v, using the first running server\n", err)
+			return runningInstances[0], nil
+		}
+
+		return leader, nil
+	}
+
+	for _, vm := range runningInstances {
+		if vm.Name == strategy || strings.HasSuffix(vm.Name, "-"+strategy) {
+			return vm, nil
+		}
+	}
+
+	return lima.LimaVM{}, fmt.Errorf("no running server matching %q in the cluster %s", strategy, c.Name)
+}
+
+// Servers returns the servers of the cluster, the running ones first, each
+// ordered by their number
+func (c ShikariCluster) Servers() []lima.LimaVM {
+	return c.orderServers(lima.GetInstancesByPrefix(c.Name))
+}
+
+// FirstServer returns the lowest-numbered running server of the cluster, or
+// the lowest-numbered server when none is running, eg: to read the files it
+// copied to the host. ok is false when the cluster has no servers.
+func (c ShikariCluster) FirstServer() (lima.LimaVM, bool) {
+	servers := c.Servers()
+
+	if len(servers) == 0 {
+		return lima.LimaVM{}, false
+	}
+
+	return servers[0], true
+}
+
+func (c ShikariCluster) orderServers(vms []lima.LimaVM) []lima.LimaVM {
+	var servers []lima.LimaVM
+
+	for _, vm := range vms {
+		if _, ok := c.getInstanceIndex(vm.Name); ok && c.getInstanceMode(vm.Name) == "server" {
+			servers = append(servers, vm)
+		}
+	}
+
+	slices.SortStableFunc(servers, func(a, b lima.LimaVM) int {
+		if ar, br := a.Status == "Running", b.Status == "Running"; ar != br {
+			if ar {
+				return -1
+			}
+			return 1
+		}
+
+		ai, _ := c.getInstanceIndex(a.Name)
+		bi, _ := c.getInstanceIndex(b.Name)
+
+		return ai - bi
+	})
+
+	return servers
+}
+
+// findLeader asks the servers which one of them is the leader of the product
+func findLeader(servers []lima.LimaVM, p Product) (lima.LimaVM, error) {
+	for _, vm := range servers {
+		output, err := lima.ExecLimaVMWithOutput(vm.Name, p.leaderCommand())
+		if err != nil {
+			continue // no answer from this server
+		}
+
+		address, _ := parseLeader(output)
+
+		leaderIP := ipv4Regex.FindString(address)
+		if leaderIP == "" {
+			continue // no leader known to this server
+		}
+
+		for _, server := range servers {
+			if server.GetIPAddress() == leaderIP {
+				return server, nil
+			}
+		}
+
+		return lima.LimaVM{}, fmt.Errorf("%s leader %s is not a running server of the cluster", p.Name, leaderIP)
+	}
+
+	return lima.LimaVM{}, fmt.Errorf("no %s leader found", p.Name)
+}
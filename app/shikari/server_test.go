@@ -0,0 +1,59 @@
+package shikari
+
+import (
+	"slices"
+	"testing"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+func TestOrderServers(t *testing.T) {
+	c := ShikariCluster{Name: "murphy"}
+
+	tests := []struct {
+		name string
+		vms  []lima.LimaVM
+		want []string
+	}{
+		{
+			"running first, by number",
+			[]lima.LimaVM{
+				{Name: "murphy-srv-01", Status: "Stopped"},
+				{Name: "murphy-srv-10", Status: "Running"},
+				{Name: "murphy-cli-01", Status: "Running"},
+				{Name: "murphy-srv-03", Status: "Running"},
+				{Name: "murphy-srv-02", Status: "Stopped"},
+			},
+			[]string{"murphy-srv-03", "murphy-srv-10", "murphy-srv-01", "murphy-srv-02"},
+		},
+		{
+			"gap after a remove",
+			[]lima.LimaVM{
+				{Name: "murphy-srv-03", Status: "Running"},
+				{Name: "murphy-srv-02", Status: "Running"},
+			},
+			[]string{"murphy-srv-02", "murphy-srv-03"},
+		},
+		{
+			"no servers",
+			[]lima.LimaVM{
+				{Name: "murphy-cli-01", Status: "Running"},
+				{Name: "murphy2-srv-01", Status: "Running"},
+			},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, vm := range c.orderServers(tt.vms) {
+				got = append(got, vm.Name)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("orderServers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
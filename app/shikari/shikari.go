@@ -5,6 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -20,6 +23,10 @@ func (c ShikariCluster) GetCurrentVMCount() (uint8, uint8) {
 
 	if len(vms) > 0 {
 		for _, vm := range vms {
+			if _, ok := c.getInstanceIndex(vm.Name); !ok {
+				continue // not a VM of this cluster
+			}
+
 			if strings.HasPrefix(vm.Name, fmt.Sprintf("%s-cli", c.Name)) {
 				clientCount++
 			} else {
@@ -45,25 +52,38 @@ func (c ShikariCluster) CreateCluster(scale bool) {
 	var serverScaleDown, clientScaleDown bool
 
 	if scale {
-		// If request > existing count, generate server instance name from the existing count
+		// Counts that were not requested stay as they are
+		if !c.ScaleServers {
+			c.NumServers = serverCount
+		}
+
+		if !c.ScaleClients {
+			c.NumClients = clientCount
+		}
+
+		// Existing VMs may have gaps in their numbering (eg: after a remove), so
+		// new VMs fill the lowest free numbers and scale down removes the highest.
+		serverIndexes := c.getInstanceIndexes("server")
+		clientIndexes := c.getInstanceIndexes("client")
+
 		if c.NumServers > serverCount {
-			serverVMs = c.generateServerInstanceNames(int(serverCount)+1, int(c.NumServers))
+			serverVMs = c.generateInstanceNames("server", freeIndexes(serverIndexes, int(c.NumServers-serverCount)))
 			vmsToCreate = append(vmsToCreate, serverVMs...)
 		}
 
-		if c.NumServers < serverCount && c.NumServers != 0 {
-			serverVMs = c.generateServerInstanceNames(int(c.NumServers)+1, int(serverCount))
+		if c.NumServers < serverCount {
+			serverVMs = c.generateInstanceNames("server", serverIndexes[c.NumServers:])
 			serverScaleDown = true
 			vmsToDestroy = append(vmsToDestroy, serverVMs...)
 		}
 
 		if c.NumClients > clientCount {
-			clientVMs = c.generateClientInstanceNames(int(clientCount)+1, int(c.NumClients))
+			clientVMs = c.generateInstanceNames("client", freeIndexes(clientIndexes, int(c.NumClients-clientCount)))
 			vmsToCreate = append(vmsToCreate, clientVMs...)
 		}
 
-		if c.NumClients < clientCount && c.NumClients != 0 {
-			clientVMs = c.generateClientInstanceNames(int(c.NumClients)+1, int(clientCount))
+		if c.NumClients < clientCount {
+			clientVMs = c.generateInstanceNames("client", clientIndexes[c.NumClients:])
 			vmsToDestroy = append(vmsToDestroy, clientVMs...)
 			clientScaleDown = true
 		}
@@ -80,20 +100,68 @@ func (c ShikariCluster) CreateCluster(scale bool) {
 		vmsToCreate = append(vmsToCreate, clientVMs...)
 	}
 
-	userDefinedEnvs := c.generateEnvArgs()
+	state := c.newState()
+
+	if scale {
+		var err error
+
+		state, err = LoadState(c.Name)
+		if err != nil {
+			fmt.Printf("Error loading the state of cluster %s: %v\n", c.Name, err)
+			return
+		}
+	} else {
+		// the files left by an earlier cluster of the same name (eg: its CA,
+		// secrets or Vault keys) must not be picked up by this one
+		if err := ClearState(c.Name); err != nil {
+			fmt.Printf("Error clearing the leftover state of cluster %s: %v\n", c.Name, err)
+			return
+		}
+
+		if err := state.setGossipKeys(c.ConsulGossipKey, c.NomadGossipKey); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		if err := state.setTopology(c.Zones, c.Racks); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		if err := state.Save(); err != nil {
+			fmt.Printf("Error saving the state of cluster %s: %v\n", c.Name, err)
+			return
+		}
+	}
+
+	if err := c.writeSecrets(); err != nil {
+		fmt.Printf("Error writing the secrets of cluster %s: %v\n", c.Name, err)
+		return
+	}
+
+	// validate the user defined env vars upfront, rather than for every VM
+	if _, _, err := generateEnvArgs(c.EnvVars); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// like --env, the overrides are not kept, so scale only applies the ones given to it
+	envOverrides, err := c.parseEnvOverrides()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 
 	if len(vmsToCreate) > 0 {
-		if len(c.ImgPath) > 0 {
-			absolutePath, err := filepath.Abs(c.ImgPath)
-			if err != nil {
-				fmt.Printf("EROR: Cannot find the absolute path of the image: %s", c.ImgPath)
-				return
-			}
+		var imageArg string
+		var imageEnv []string
 
-			qcow2, _ := isQCOW2(absolutePath)
+		if len(c.ImgPath) > 0 {
+			var err error
 
-			if !qcow2 {
-				fmt.Printf("Error: Image %s is not of type qCOW2\n", absolutePath)
+			imageArg, imageEnv, err = imageExpression(c.ImgPath)
+			if err != nil {
+				fmt.Println(err)
 				return
 			}
 		}
@@ -103,7 +171,7 @@ func (c ShikariCluster) CreateCluster(scale bool) {
 
 		var tmpl string
 
-		if strings.HasSuffix(strings.ToLower(c.Template), ".yml") || strings.HasSuffix(strings.ToLower(c.Template), ".yaml") {
+		if isTemplateFile(c.Template) {
 			tmpl = c.Template
 		} else {
 			tmpl = fmt.Sprintf("template://%s", c.Template)
@@ -117,24 +185,55 @@ func (c ShikariCluster) CreateCluster(scale bool) {
 		launchModeEnvVar := fmt.Sprintf(`.env.SHIKARI_LAUNCH_MODE="%s"`, launchMode(scale))
 		yqExpression = fmt.Sprintf("%s |  %s | %s", yqExpression, countEnvVars, launchModeEnvVar)
 
-		// append user defined environment variable
-		if userDefinedEnvs != "" {
-			yqExpression = fmt.Sprintf("%s | %s", yqExpression, userDefinedEnvs)
+		// append the gossip keys, the same on every VM so that scaled VMs can join
+		if gossipEnvVars := state.gossipExpression(); gossipEnvVars != "" {
+			yqExpression = fmt.Sprintf("%s | %s", yqExpression, gossipEnvVars)
 		}
 
-		// // Override the image from the template
-		if len(c.ImgPath) > 0 {
-			absolutePath, _ := filepath.Abs(c.ImgPath)
-			imageArg := fmt.Sprintf(`.images=[{"location": "%s"}]`, absolutePath)
+		// Override the image from the template
+		if imageArg != "" {
 			yqExpression = fmt.Sprintf("%s | %s", yqExpression, imageArg)
 		}
 
 		// Spawn Lima VMs concurrently
 		for _, vmName := range vmsToCreate {
-			wg.Add(1)
 			yqExpr := fmt.Sprintf(`%s | .env.SHIKARI_VM_MODE="%s"`, yqExpression, c.getInstanceMode(vmName))
 
-			go lima.SpawnLimaVM(vmName, c.Arch, tmpl, yqExpr, &wg, errCh)
+			// place the VM in its zone and rack
+			index, _ := c.getInstanceIndex(vmName)
+
+			if topologyExpr := state.topologyExpression(index); topologyExpr != "" {
+				yqExpr = fmt.Sprintf("%s | %s", yqExpr, topologyExpr)
+			}
+
+			// append user defined environment variables, with the overrides of the role and VM
+			userDefinedEnvs, envValues, err := generateEnvArgs(c.envVarsFor(vmName, envOverrides))
+			if err != nil {
+				errCh <- err
+				continue
+			}
+
+			if userDefinedEnvs != "" {
+				yqExpr = fmt.Sprintf("%s | %s", yqExpr, userDefinedEnvs)
+			}
+
+			// deliver the certificate issued by the host-side PKI and the secrets, exposing only their paths
+			provisionExpr, provisionEnv, err := state.provisionExpression(vmName)
+			if err != nil {
+				errCh <- err
+				continue
+			}
+
+			if provisionExpr != "" {
+				yqExpr = fmt.Sprintf("%s | %s", yqExpr, provisionExpr)
+			}
+
+			envValues = append(envValues, imageEnv...)
+			envValues = append(envValues, provisionEnv...)
+
+			wg.Add(1)
+
+			go lima.SpawnLimaVM(vmName, c.Arch, tmpl, yqExpr, envValues, &wg, errCh)
 			yqExpr = ""
 
 		}
@@ -149,6 +248,10 @@ func (c ShikariCluster) CreateCluster(scale bool) {
 		for err := range errCh {
 			fmt.Println(err)
 		}
+
+		if err := c.FinishProvisioning(); err != nil {
+			fmt.Println(err)
+		}
 	}
 
 	if len(vmsToDestroy) > 0 {
@@ -174,6 +277,32 @@ func (c ShikariCluster) CreateCluster(scale bool) {
 
 }
 
+func (c ShikariCluster) newState() ClusterState {
+	state := ClusterState{
+		Name:      c.Name,
+		Template:  c.Template,
+		Arch:      c.Arch,
+		PKI:       c.PKI,
+		CreatedAt: time.Now(),
+	}
+
+	// scale can run from another directory
+	if isTemplateFile(c.Template) {
+		state.Template, _ = filepath.Abs(c.Template)
+	}
+
+	if len(c.ImgPath) > 0 {
+		state.Image, _ = filepath.Abs(c.ImgPath)
+	}
+
+	return state
+}
+
+// isTemplateFile reports whether the template is a file rather than one of the templates of Lima
+func isTemplateFile(tmpl string) bool {
+	return strings.HasSuffix(strings.ToLower(tmpl), ".yml") || strings.HasSuffix(strings.ToLower(tmpl), ".yaml")
+}
+
 func (c ShikariCluster) generateServerInstanceNames(start int, end int) []string {
 
 	s := make([]string, 0)
@@ -198,27 +327,219 @@ func (c ShikariCluster) generateClientInstanceNames(start int, end int) []string
 	return s
 }
 
-func (c ShikariCluster) generateEnvArgs() string {
-	envs := c.EnvVars
+// generateInstanceNames returns the names of the VMs of the given mode with the given indexes
+func (c ShikariCluster) generateInstanceNames(mode string, indexes []int) []string {
+
+	s := make([]string, 0)
+
+	for _, n := range indexes {
+		s = append(s, c.instanceName(mode, n))
+	}
+	return s
+}
+
+func (c ShikariCluster) instanceName(mode string, index int) string {
+	if mode == "client" {
+		return fmt.Sprintf("%s-cli-%02d", c.Name, index)
+	}
+
+	return fmt.Sprintf("%s-srv-%02d", c.Name, index)
+}
+
+// getInstanceIndexes returns the sorted indexes of the existing VMs of the given mode
+func (c ShikariCluster) getInstanceIndexes(mode string) []int {
+	var indexes []int
+
+	for _, vm := range lima.GetInstancesByPrefix(c.Name) {
+		if index, ok := c.getInstanceIndex(vm.Name); ok && c.getInstanceMode(vm.Name) == mode {
+			indexes = append(indexes, index)
+		}
+	}
+
+	sort.Ints(indexes)
+
+	return indexes
+}
+
+// getInstanceIndex parses the trailing number of a VM name, eg: 2 for murphy-srv-02
+func (c ShikariCluster) getInstanceIndex(instanceName string) (int, bool) {
+	pattern := fmt.Sprintf(`^%s-(srv|cli)-(\d+)$`, regexp.QuoteMeta(c.Name))
+	matches := regexp.MustCompile(pattern).FindStringSubmatch(instanceName)
+
+	if matches == nil {
+		return 0, false
+	}
+
+	index, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return 0, false
+	}
+
+	return index, true
+}
+
+// freeIndexes returns the lowest count indexes (starting from 1) not present in the sorted existing indexes
+func freeIndexes(existing []int, count int) []int {
+	var free []int
+
+	for n := 1; len(free) < count; n++ {
+		if !slices.Contains(existing, n) {
+			free = append(free, n)
+		}
+	}
+
+	return free
+}
+
+// ReplaceInstance destroys the named VM and recreates it with the same name,
+// role and environment, using the Lima configuration of the existing VM. The
+// yqExpression, if not empty, is applied on top of that configuration, with
+// env added to the environment of limactl.
+func (c ShikariCluster) ReplaceInstance(vmName string, yqExpression string, env []string) error {
+	vm := lima.GetInstance(vmName)
+
+	if vm.Name == "" {
+		return fmt.Errorf("no instance found with the name %q", vmName)
+	}
+
+	config, err := os.ReadFile(filepath.Join(vm.GetVMDir(), "lima.yaml"))
+	if err != nil {
+		return fmt.Errorf("error reading the configuration of %s: %w", vmName, err)
+	}
+
+	// Keep a copy of the configuration as the VM directory goes away on delete.
+	// It is only removed once the VM is back, so that it can be recreated by hand.
+	tmpl, err := os.CreateTemp("", fmt.Sprintf("%s-*.yaml", vmName))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmpl.Write(config); err != nil {
+		tmpl.Close()
+		os.Remove(tmpl.Name())
+		return err
+	}
+	tmpl.Close()
+
+	state, err := LoadState(c.Name)
+	if err != nil {
+		os.Remove(tmpl.Name())
+		return err
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, 1)
+
+	wg.Add(1)
+	lima.DeleteLimaVM(vmName, true, &wg, errCh)
+
+	if len(errCh) > 0 {
+		os.Remove(tmpl.Name())
+		return <-errCh
+	}
+
+	// The replaced VM joins an already running cluster
+	yqExpr := fmt.Sprintf(`.env.SHIKARI_LAUNCH_MODE="%s"`, launchMode(true))
+
+	// the files delivered at the first boot are gone from the staging directory by now
+	provisionExpr, provisionEnv, err := state.provisionExpression(vmName)
+	if err != nil {
+		return fmt.Errorf("%w (the configuration of %s is kept in %s)", err, vmName, tmpl.Name())
+	}
+
+	if provisionExpr != "" {
+		yqExpr = fmt.Sprintf("%s | %s", yqExpr, provisionExpr)
+	}
+
+	if yqExpression != "" {
+		yqExpr = fmt.Sprintf("%s | %s", yqExpr, yqExpression)
+	}
+
+	wg.Add(1)
+	lima.SpawnLimaVM(vmName, vm.Arch, tmpl.Name(), yqExpr, append(provisionEnv, env...), &wg, errCh)
+
+	if len(errCh) > 0 {
+		return fmt.Errorf("%w (the configuration of %s is kept in %s)", <-errCh, vmName, tmpl.Name())
+	}
+
+	os.Remove(tmpl.Name())
+
+	return state.finishProvisioning(vmName)
+}
+
+// envValuePrefix prefixes the names of the limactl environment variables carrying the user defined values
+const envValuePrefix = "SHIKARI_ENV_VALUE_"
 
+// envKeyRegex matches the valid names of environment variables
+var envKeyRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// generateEnvArgs returns the yq expression setting the user defined environment
+// variables, along with the environment of limactl it reads the values from.
+// The values never appear in the expression, so they need no quoting.
+func generateEnvArgs(envs []string) (string, []string, error) {
 	var envCSV []string
+	var values []string
+
 	for _, e := range envs {
-		if !strings.Contains(e, "=") {
-			fmt.Println("Invalid env format")
-			os.Exit(1)
+		kv := strings.SplitN(e, "=", 2)
+
+		if len(kv) != 2 || kv[1] == "" {
+			return "", nil, fmt.Errorf("invalid env format %q, expected KEY=VALUE", e)
 		}
 
-		kv := strings.SplitN(e, "=", 2)
+		if !envKeyRegex.MatchString(kv[0]) {
+			return "", nil, fmt.Errorf("invalid env name %q, must be a valid environment variable name", kv[0])
+		}
+
+		envCSV = append(envCSV, fmt.Sprintf(".env.%s=strenv(%s%s)", kv[0], envValuePrefix, kv[0]))
+		values = append(values, envValuePrefix+e)
+	}
+
+	return strings.Join(envCSV, " | "), values, nil
+}
+
+// MergeEnvVars removes the duplicate variables, the last value of a variable
+// winning while it keeps the position of its first occurrence
+func MergeEnvVars(envs []string) []string {
+	var merged []string
+	index := make(map[string]int)
+
+	for _, e := range envs {
+		key, _, _ := strings.Cut(e, "=")
 
-		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
-			fmt.Println("Invalid env format")
-			os.Exit(1)
+		if i, ok := index[key]; ok {
+			merged[i] = e
+			continue
 		}
 
-		envCSV = append(envCSV, fmt.Sprintf(".env.%s=\"%s\"", kv[0], kv[1]))
+		index[key] = len(merged)
+		merged = append(merged, e)
+	}
+
+	return merged
+}
+
+// pathEnvPrefix prefixes the names of the limactl environment variables
+// carrying the host paths read by the yq expressions, so that they need no
+// quoting either
+const pathEnvPrefix = "SHIKARI_PATH_"
+
+// imageExpression returns the yq expression overriding the images of the
+// template with the given qcow2 image, along with the environment of limactl
+// it reads the path from
+func imageExpression(imgPath string) (string, []string, error) {
+	absolutePath, err := filepath.Abs(imgPath)
+	if err != nil {
+		return "", nil, fmt.Errorf("error: cannot find the absolute path of the image: %s", imgPath)
+	}
+
+	qcow2, _ := isQCOW2(absolutePath)
+
+	if !qcow2 {
+		return "", nil, fmt.Errorf("error: image %s is not of type qCOW2", absolutePath)
 	}
 
-	return strings.Join(envCSV, "| ")
+	return fmt.Sprintf(`.images=[{"location": strenv(%sIMAGE)}]`, pathEnvPrefix), []string{pathEnvPrefix + "IMAGE=" + absolutePath}, nil
 }
 
 func isQCOW2(filePath string) (bool, error) {
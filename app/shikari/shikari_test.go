@@ -0,0 +1,78 @@
+package shikari
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFreeIndexes(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []int
+		count    int
+		want     []int
+	}{
+		{"empty", nil, 3, []int{1, 2, 3}},
+		{"contiguous", []int{1, 2, 3}, 2, []int{4, 5}},
+		{"gaps", []int{1, 3, 5}, 3, []int{2, 4, 6}},
+		{"leading gap", []int{2, 3}, 1, []int{1}},
+		{"none", []int{1, 2}, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := freeIndexes(tt.existing, tt.count); !slices.Equal(got, tt.want) {
+				t.Errorf("freeIndexes(%v, %d) = %v, want %v", tt.existing, tt.count, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetInstanceIndex(t *testing.T) {
+	c := ShikariCluster{Name: "murphy"}
+
+	tests := []struct {
+		vmName string
+		want   int
+		ok     bool
+	}{
+		{"murphy-srv-01", 1, true},
+		{"murphy-cli-12", 12, true},
+		{"murphy-srv-100", 100, true},
+		{"murphy2-srv-01", 0, false},
+		{"murphy-srv-", 0, false},
+		{"murphy-web-01", 0, false},
+		{"other-srv-01", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.vmName, func(t *testing.T) {
+			got, ok := c.getInstanceIndex(tt.vmName)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("getInstanceIndex(%q) = %d, %t, want %d, %t", tt.vmName, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestMergeEnvVars(t *testing.T) {
+	tests := []struct {
+		name string
+		envs []string
+		want []string
+	}{
+		{"empty", nil, nil},
+		{"no duplicates", []string{"A=1", "B=2"}, []string{"A=1", "B=2"}},
+		{"last value wins", []string{"A=1", "B=2", "A=3"}, []string{"A=3", "B=2"}},
+		{"repeated overrides", []string{"A=1", "A=2", "B=2", "A=3"}, []string{"A=3", "B=2"}},
+		{"values with equal signs", []string{"A=b=c", "A=d=e"}, []string{"A=d=e"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeEnvVars(tt.envs); !slices.Equal(got, tt.want) {
+				t.Errorf("MergeEnvVars(%v) = %v, want %v", tt.envs, got, tt.want)
+			}
+		})
+	}
+}
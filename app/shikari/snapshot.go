@@ -0,0 +1,99 @@
+package shikari
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// CreateSnapshot snapshots every VM of the cluster under the same tag
+func (c ShikariCluster) CreateSnapshot(tag string) error {
+	return c.snapshotAll("create", tag)
+}
+
+// ApplySnapshot restores every VM of the cluster to the snapshot with the tag.
+// Nothing is touched unless all the VMs have a snapshot with the tag.
+func (c ShikariCluster) ApplySnapshot(tag string) error {
+	snapshots, err := c.ListSnapshots()
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots[tag]) != len(lima.GetInstancesByPrefix(c.Name)) {
+		return fmt.Errorf("snapshot %q does not exist for all the VMs of the cluster %s", tag, c.Name)
+	}
+
+	return c.snapshotAll("apply", tag)
+}
+
+// DeleteSnapshot deletes the snapshot with the tag from every VM of the cluster that has it
+func (c ShikariCluster) DeleteSnapshot(tag string) error {
+	snapshots, err := c.ListSnapshots()
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots[tag]) == 0 {
+		return fmt.Errorf("snapshot %q does not exist in the cluster %s", tag, c.Name)
+	}
+
+	return c.snapshotAll("delete", tag)
+}
+
+// ListSnapshots returns the names of the VMs having a snapshot, keyed by the snapshot tag
+func (c ShikariCluster) ListSnapshots() (map[string][]string, error) {
+	snapshots := make(map[string][]string)
+
+	for _, vm := range lima.GetInstancesByPrefix(c.Name) {
+		tags, err := lima.ListLimaVMSnapshots(vm.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range tags {
+			snapshots[tag] = append(snapshots[tag], vm.Name)
+		}
+	}
+
+	return snapshots, nil
+}
+
+// snapshotAll runs the snapshot action against all the VMs of the cluster
+// while they are stopped, and starts the previously running VMs again.
+func (c ShikariCluster) snapshotAll(action string, tag string) error {
+	vms := lima.GetInstancesByPrefix(c.Name)
+
+	if len(vms) == 0 {
+		return fmt.Errorf("no instances in the cluster %s", c.Name)
+	}
+
+	running, err := c.stopRunningInstances()
+	if err != nil {
+		// start the VMs that did stop, rather than leaving them down
+		return errors.Join(err, startInstances(running))
+	}
+
+	var errs []error
+
+	for _, vm := range vms {
+		// delete only applies to the VMs having the snapshot
+		if action == "delete" {
+			tags, err := lima.ListLimaVMSnapshots(vm.Name)
+			if err != nil || !slices.Contains(tags, tag) {
+				continue
+			}
+		}
+
+		if err := lima.SnapshotLimaVM(action, vm.Name, tag); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := startInstances(running); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,167 @@
+package shikari
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const stateFileName = "state.json"
+
+// ClusterState is what Shikari keeps about a cluster on the host, in addition
+// to what is stored in the Lima instances. It lives in the state directory of
+// the cluster, along with any other cluster specific files.
+type ClusterState struct {
+	Name       string    `json:"name"`
+	Template   string    `json:"template,omitempty"` // template, architecture and image used by scale unless given
+	Arch       string    `json:"arch,omitempty"`
+	Image      string    `json:"image,omitempty"` // updated by a rollout with a new image
+	ClonedFrom string    `json:"cloned_from,omitempty"`
+	PKI        bool      `json:"pki,omitempty"` // whether the cluster uses the host-side PKI
+	CreatedAt  time.Time `json:"created_at"`
+
+	ConsulGossipKey string `json:"consul_gossip_key,omitempty"`
+	NomadGossipKey  string `json:"nomad_gossip_key,omitempty"`
+
+	KubeConfig *MergedKubeConfig `json:"kubeconfig,omitempty"` // entries merged into the kubeconfig of the user
+
+	Zones []string `json:"zones,omitempty"` // zones the VMs are spread over
+	Racks []string `json:"racks,omitempty"` // racks the VMs of each zone are spread over
+
+	Faults []Fault `json:"faults,omitempty"` // active faults injected by chaos
+}
+
+// StateDir returns the state directory of the cluster, eg: ~/.shikari/clusters/murphy
+func StateDir(clusterName string) (string, error) {
+	homePath, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homePath, ".shikari", "clusters", clusterName), nil
+}
+
+// LoadState reads the state of the cluster. Clusters without a state file
+// (eg: created by older versions) get an empty state carrying only the name.
+func LoadState(clusterName string) (ClusterState, error) {
+	state := ClusterState{Name: clusterName}
+
+	dir, err := StateDir(clusterName)
+	if err != nil {
+		return state, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, stateFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("error reading the state of cluster %s: %w", clusterName, err)
+	}
+
+	return state, nil
+}
+
+// Save writes the state into the state directory of the cluster
+func (s ClusterState) Save() error {
+	dir, err := StateDir(s.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, stateFileName), data, 0600)
+}
+
+// DeleteState removes the state directory of the cluster
+func DeleteState(clusterName string) error {
+	dir, err := StateDir(clusterName)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// ClearState removes the kubeconfig entries merged for the cluster and its
+// state directory, eg: once all its VMs are gone
+func ClearState(clusterName string) error {
+	dir, err := StateDir(clusterName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err := RemoveKubeConfig(clusterName); err != nil {
+		return fmt.Errorf("error removing the kubeconfig context of cluster %s: %w", clusterName, err)
+	}
+
+	return DeleteState(clusterName)
+}
+
+// copyStateDir copies the files of the state directory of the cluster into
+// the state directory of another cluster, leaving out the state file itself.
+func copyStateDir(clusterName string, newClusterName string) error {
+	src, err := StateDir(clusterName)
+	if err != nil {
+		return err
+	}
+
+	dst, err := StateDir(newClusterName)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == src {
+			return filepath.SkipDir // nothing to copy
+		}
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil || rel == stateFileName {
+			return err
+		}
+
+		if isStagedFile(rel) {
+			return nil // staged for the VMs of the cluster being copied
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), info.Mode().Perm())
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		return os.WriteFile(filepath.Join(dst, rel), data, info.Mode().Perm())
+	})
+}
@@ -0,0 +1,63 @@
+package shikari
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClearState(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// nothing to clear
+	if err := ClearState("murphy"); err != nil {
+		t.Fatalf("ClearState without a state directory: %v", err)
+	}
+
+	state := ClusterState{Name: "murphy", PKI: true}
+
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := StateDir("murphy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "vault-init.json"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ClearState("murphy"); err != nil {
+		t.Fatalf("ClearState: %v", err)
+	}
+
+	if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("state directory %s left behind", dir)
+	}
+}
+
+func TestNewStateTemplate(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"./hashibox.yaml", filepath.Join(wd, "hashibox.yaml")},
+		{"/srv/templates/hashibox.YML", "/srv/templates/hashibox.YML"},
+		{"ubuntu-lts", "ubuntu-lts"},
+	}
+
+	for _, tt := range tests {
+		if got := (ShikariCluster{Name: "murphy", Template: tt.template}).newState().Template; got != tt.want {
+			t.Errorf("newState().Template for %q = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package shikari
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// StressOpts configures the resource stress of the VMs
+type StressOpts struct {
+	Target   string        // selector of the VMs to stress
+	CPU      int           // number of CPU workers
+	Memory   string        // percentage of the memory to use, eg: 80%
+	DiskFill string        // percentage of the root filesystem to fill, eg: 90%
+	Duration time.Duration // how long the stress lasts
+}
+
+// Stress runs stress workloads inside the VMs matching the target for the
+// duration, using stress-ng when available and falling back to yes, tail and
+// fallocate otherwise. The workloads run as a transient systemd unit, so they
+// outlive the session and are cleaned up after the duration, or when healed.
+func (c ShikariCluster) Stress(opts StressOpts) (Fault, error) {
+	if opts.Duration < time.Second {
+		return Fault{}, fmt.Errorf("the duration must be at least 1s")
+	}
+
+	memory, err := parsePercent(opts.Memory, 99)
+	if err != nil {
+		return Fault{}, fmt.Errorf("invalid memory %q: %w", opts.Memory, err)
+	}
+
+	disk, err := parsePercent(opts.DiskFill, 100)
+	if err != nil {
+		return Fault{}, fmt.Errorf("invalid disk fill %q: %w", opts.DiskFill, err)
+	}
+
+	if opts.CPU < 0 || opts.CPU == 0 && memory == 0 && disk == 0 {
+		return Fault{}, fmt.Errorf("nothing to stress, set at least one of cpu, memory or disk fill")
+	}
+
+	vms, err := c.runningTargets(opts.Target)
+	if err != nil {
+		return Fault{}, err
+	}
+
+	state, err := LoadState(c.Name)
+	if err != nil {
+		return Fault{}, err
+	}
+
+	unit := "shikari-" + state.nextFaultID("stress")
+	fillFile := fmt.Sprintf("/var/tmp/%s.fill", unit)
+	seconds := int(opts.Duration.Seconds())
+
+	script := stressScript(opts.CPU, memory, disk, seconds, fillFile)
+
+	apply := make(map[string]string)
+	undo := make(map[string]string)
+
+	for _, vm := range vms {
+		apply[vm.Name] = fmt.Sprintf("sudo systemd-run --quiet --collect --unit %s sh -c %s", unit, lima.ShellQuote(script))
+		undo[vm.Name] = fmt.Sprintf("sudo systemctl stop %s.service 2>/dev/null; sudo rm -f %s", unit, fillFile)
+	}
+
+	var details []string
+
+	if opts.CPU > 0 {
+		details = append(details, fmt.Sprintf("cpu %d", opts.CPU))
+	}
+	if memory > 0 {
+		details = append(details, fmt.Sprintf("memory %d%%", memory))
+	}
+	if disk > 0 {
+		details = append(details, fmt.Sprintf("disk %d%%", disk))
+	}
+
+	expiresAt := time.Now().Add(opts.Duration)
+
+	return state.injectFault(Fault{
+		Kind:      "stress",
+		Details:   fmt.Sprintf("%s for %s on %s", strings.Join(details, ", "), opts.Duration, opts.Target),
+		Undo:      undo,
+		ExpiresAt: &expiresAt,
+	}, apply)
+}
+
+// stressScript returns the shell script running the stress workloads for the
+// given number of seconds and removing the file filling the disk afterwards
+func stressScript(cpu int, memory int, disk int, seconds int, fillFile string) string {
+	lines := []string{
+		fmt.Sprintf("trap 'rm -f %s; exit' INT TERM", fillFile),
+	}
+
+	if disk > 0 {
+		lines = append(lines,
+			fmt.Sprintf(`fill=$(df --output=size,used -B1 / | awk 'NR == 2 { printf "%%.0f", $1 * %d / 100 - $2 }')`, disk),
+			fmt.Sprintf(`if [ "$fill" -gt 0 ]; then fallocate -l "$fill" %s; fi`, fillFile))
+	}
+
+	if cpu > 0 || memory > 0 {
+		var stressNG []string
+
+		if cpu > 0 {
+			stressNG = append(stressNG, fmt.Sprintf("--cpu %d", cpu))
+		}
+		if memory > 0 {
+			stressNG = append(stressNG, fmt.Sprintf("--vm 1 --vm-bytes %d%% --vm-keep", memory))
+		}
+
+		lines = append(lines,
+			"if command -v stress-ng >/dev/null 2>&1; then",
+			fmt.Sprintf("  stress-ng %s --timeout %ds &", strings.Join(stressNG, " "), seconds),
+			"else")
+
+		if cpu > 0 {
+			lines = append(lines, fmt.Sprintf("  for i in $(seq %d); do timeout %d yes >/dev/null & done", cpu, seconds))
+		}
+		if memory > 0 {
+			// tail keeps the whole input in memory, as /dev/zero has no newlines
+			lines = append(lines, fmt.Sprintf(`  head -c "$(awk '/MemTotal/ { printf "%%.0f", $2 * %d / 100 }' /proc/meminfo)K" /dev/zero | timeout %d tail >/dev/null &`, memory, seconds))
+		}
+
+		lines = append(lines, "fi")
+	}
+
+	lines = append(lines,
+		fmt.Sprintf("sleep %d", seconds),
+		"wait",
+		"rm -f "+fillFile)
+
+	return strings.Join(lines, "\n")
+}
+
+// parsePercent parses a percentage such as 80% (or 80) between 0 and max
+func parsePercent(s string, max int) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	percent, err := strconv.Atoi(strings.TrimSuffix(s, "%"))
+	if err != nil || percent < 0 || percent > max {
+		return 0, fmt.Errorf("must be a percentage between 0 and %d", max)
+	}
+
+	return percent, nil
+}
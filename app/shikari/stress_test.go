@@ -0,0 +1,34 @@
+package shikari
+
+import "testing"
+
+func TestParsePercent(t *testing.T) {
+	tests := []struct {
+		in      string
+		max     int
+		want    int
+		wantErr bool
+	}{
+		{"", 100, 0, false},
+		{"80%", 100, 80, false},
+		{"80", 100, 80, false},
+		{"0%", 100, 0, false},
+		{"100%", 99, 0, true},
+		{"-5%", 100, 0, true},
+		{"12.5%", 100, 0, true},
+		{"%", 100, 0, true},
+		{"eighty", 100, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePercent(tt.in, tt.max)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePercent(%q, %d) error = %v, wantErr %v", tt.in, tt.max, err, tt.wantErr)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("parsePercent(%q, %d) = %d, want %d", tt.in, tt.max, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package shikari
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// topologyNameRegex matches the valid names of zones and racks
+var topologyNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// selectorKeywords cannot be used as zone or rack names, as they are selector terms
+var selectorKeywords = []string{"all", "servers", "clients"}
+
+// setTopology parses the zone and rack layouts of the cluster into the state.
+// A layout is either a count (eg: 3 for zone-a, zone-b and zone-c, or rack-1,
+// rack-2 and rack-3) or a comma separated list of names.
+func (s *ClusterState) setTopology(zones string, racks string) error {
+	var err error
+
+	if s.Zones, err = parseTopology(zones, func(i int) string { return fmt.Sprintf("zone-%c", 'a'+i) }, 26); err != nil {
+		return fmt.Errorf("invalid zones %q: %w", zones, err)
+	}
+
+	if s.Racks, err = parseTopology(racks, func(i int) string { return fmt.Sprintf("rack-%d", i+1) }, 99); err != nil {
+		return fmt.Errorf("invalid racks %q: %w", racks, err)
+	}
+
+	for _, rack := range s.Racks {
+		if slices.Contains(s.Zones, rack) {
+			return fmt.Errorf("%s cannot be both a zone and a rack", rack)
+		}
+	}
+
+	return nil
+}
+
+func parseTopology(layout string, name func(int) string, max int) ([]string, error) {
+	if layout == "" {
+		return nil, nil
+	}
+
+	if count, err := strconv.Atoi(layout); err == nil {
+		if count < 1 || count > max {
+			return nil, fmt.Errorf("count must be between 1 and %d", max)
+		}
+
+		names := make([]string, count)
+		for i := range names {
+			names[i] = name(i)
+		}
+
+		return names, nil
+	}
+
+	names := strings.Split(layout, ",")
+
+	for i, n := range names {
+		if !topologyNameRegex.MatchString(n) || slices.Contains(selectorKeywords, n) || isInstanceSuffix(n) {
+			return nil, fmt.Errorf("invalid name %q", n)
+		}
+
+		if slices.Contains(names[:i], n) {
+			return nil, fmt.Errorf("duplicate name %q", n)
+		}
+	}
+
+	return names, nil
+}
+
+// placement returns the zone and rack of the VM with the given index. VMs of
+// each kind are spread round-robin over the zones, and over the racks of a zone.
+func (s ClusterState) placement(index int) (string, string) {
+	var zone, rack string
+
+	position := max(index-1, 0)
+	zones := max(len(s.Zones), 1)
+
+	if len(s.Zones) > 0 {
+		zone = s.Zones[position%zones]
+	}
+
+	if len(s.Racks) > 0 {
+		rack = s.Racks[(position/zones)%len(s.Racks)]
+	}
+
+	return zone, rack
+}
+
+// topologyExpression returns the yq expression injecting the zone and rack of the VM with the given index
+func (s ClusterState) topologyExpression(index int) string {
+	var envs []string
+
+	zone, rack := s.placement(index)
+
+	if zone != "" {
+		envs = append(envs, fmt.Sprintf(`.env.SHIKARI_ZONE="%s"`, zone))
+	}
+
+	if rack != "" {
+		envs = append(envs, fmt.Sprintf(`.env.SHIKARI_RACK="%s"`, rack))
+	}
+
+	return strings.Join(envs, " | ")
+}
@@ -0,0 +1,125 @@
+package shikari
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+func TestParseTopology(t *testing.T) {
+	zoneName := func(i int) string { return fmt.Sprintf("zone-%c", 'a'+i) }
+
+	tests := []struct {
+		name    string
+		layout  string
+		want    []string
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"count", "3", []string{"zone-a", "zone-b", "zone-c"}, false},
+		{"names", "east,west", []string{"east", "west"}, false},
+		{"zero count", "0", nil, true},
+		{"count above the maximum", "27", nil, true},
+		{"duplicate name", "east,east", nil, true},
+		{"selector keyword", "servers", nil, true},
+		{"instance suffix", "srv-01", nil, true},
+		{"uppercase name", "East", nil, true},
+		{"empty name", "east,", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTopology(tt.layout, zoneName, 26)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTopology(%q) error = %v, wantErr %v", tt.layout, err, tt.wantErr)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseTopology(%q) = %v, want %v", tt.layout, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTopologyZoneAndRackClash(t *testing.T) {
+	var s ClusterState
+
+	if err := s.setTopology("a,b", "b,c"); err == nil {
+		t.Error("setTopology() accepted b as both a zone and a rack")
+	}
+}
+
+func TestPlacement(t *testing.T) {
+	tests := []struct {
+		name     string
+		zones    []string
+		racks    []string
+		index    int
+		wantZone string
+		wantRack string
+	}{
+		{"no topology", nil, nil, 1, "", ""},
+		{"first VM", []string{"a", "b", "c"}, nil, 1, "a", ""},
+		{"round-robin over zones", []string{"a", "b", "c"}, nil, 5, "b", ""},
+		{"racks only", nil, []string{"r1", "r2"}, 3, "", "r1"},
+		{"first rack of each zone", []string{"a", "b"}, []string{"r1", "r2"}, 2, "b", "r1"},
+		{"second rack once the zones are full", []string{"a", "b"}, []string{"r1", "r2"}, 3, "a", "r2"},
+		{"racks wrap around", []string{"a", "b"}, []string{"r1", "r2"}, 5, "a", "r1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := ClusterState{Zones: tt.zones, Racks: tt.racks}
+
+			zone, rack := s.placement(tt.index)
+			if zone != tt.wantZone || rack != tt.wantRack {
+				t.Errorf("placement(%d) = %q, %q, want %q, %q", tt.index, zone, rack, tt.wantZone, tt.wantRack)
+			}
+		})
+	}
+}
+
+func TestMatchesTerm(t *testing.T) {
+	c := ShikariCluster{Name: "murphy"}
+
+	vm := func(name string, zone string, rack string) lima.LimaVM {
+		env := map[string]string{}
+		if zone != "" {
+			env["SHIKARI_ZONE"] = zone
+		}
+		if rack != "" {
+			env["SHIKARI_RACK"] = rack
+		}
+
+		return lima.LimaVM{Name: name, Config: lima.Config{Env: env}}
+	}
+
+	srv := vm("murphy-srv-01", "zone-a", "rack-1")
+	cli := vm("murphy-cli-02", "", "")
+
+	tests := []struct {
+		term string
+		vm   lima.LimaVM
+		want bool
+	}{
+		{"all", cli, true},
+		{"servers", srv, true},
+		{"servers", cli, false},
+		{"clients", cli, true},
+		{"srv-01", srv, true},
+		{"murphy-srv-01", srv, true},
+		{"srv-02", srv, false},
+		{"zone-a", srv, true},
+		{"rack-1", srv, true},
+		{"zone-b", srv, false},
+		{"", cli, false},
+	}
+
+	for _, tt := range tests {
+		if got := c.matchesTerm(tt.vm, tt.term); got != tt.want {
+			t.Errorf("matchesTerm(%s, %q) = %v, want %v", tt.vm.Name, tt.term, got, tt.want)
+		}
+	}
+}
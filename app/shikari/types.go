@@ -1,12 +1,29 @@
 package shikari
 
 type ShikariCluster struct {
-	Name       string
-	Arch       string
-	NumServers uint8
-	NumClients uint8
-	Template   string
-	EnvVars    []string
-	ImgPath    string
-	Force      bool // flag to whether force operations
+	Name        string
+	Arch        string
+	NumServers  uint8
+	NumClients  uint8
+	Template    string
+	EnvVars     []string
+	NodeEnvVars []string // per role or per node overrides of EnvVars, eg: srv-01:KEY=VALUE
+	Secrets     []string // KEY=VALUE pairs copied into the VMs as files
+	ImgPath     string
+	Force       bool // flag to whether force operations
+	PKI         bool // issue the TLS certificates of the VMs from a CA on the host
+
+	// Gossip encryption keys, generated when not given
+	ConsulGossipKey string
+	NomadGossipKey  string
+
+	// Failure domains the VMs are spread over: a count or comma separated names
+	Zones string
+	Racks string // within each zone
+
+	// ScaleServers and ScaleClients record whether the respective count was
+	// explicitly requested when scaling, so that an explicit zero can be told
+	// apart from the flag default.
+	ScaleServers bool
+	ScaleClients bool
 }
@@ -0,0 +1,182 @@
+package shikari
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+)
+
+// Files in the state directory of the cluster holding the output of vault
+// operator init and the root token
+const (
+	VaultInitFile      = "vault-init.json"
+	VaultRootTokenFile = "vault-root-token"
+)
+
+type VaultOpts struct {
+	TLS          bool // whether the Vault listener has TLS enabled
+	KeyShares    int
+	KeyThreshold int
+}
+
+// vaultInit is the output of vault operator init -format=json
+type vaultInit struct {
+	UnsealKeysB64   []string `json:"unseal_keys_b64"`
+	UnsealThreshold int      `json:"unseal_threshold"`
+	RootToken       string   `json:"root_token"`
+}
+
+// VaultStatus is the status of Vault on a server
+type VaultStatus struct {
+	VMName      string `json:"-"`
+	Initialized bool   `json:"initialized"`
+	Sealed      bool   `json:"sealed"`
+	HAMode      string `json:"ha_mode"`
+}
+
+// VaultInit initializes Vault on the first server of the cluster, and stores
+// the unseal keys and the root token in the state directory of the cluster.
+func (c ShikariCluster) VaultInit(opts VaultOpts) error {
+	dir, err := StateDir(c.Name)
+	if err != nil {
+		return err
+	}
+
+	initPath := filepath.Join(dir, VaultInitFile)
+
+	if _, err := os.Stat(initPath); err == nil {
+		return fmt.Errorf("vault of cluster %s is already initialized, the keys are in %s", c.Name, initPath)
+	}
+
+	servers := c.runningServers()
+	if len(servers) == 0 {
+		return fmt.Errorf("no running servers in the cluster %s", c.Name)
+	}
+
+	command := fmt.Sprintf("%s vault operator init -format=json -key-shares=%d -key-threshold=%d",
+		opts.vaultEnv(), opts.KeyShares, opts.KeyThreshold)
+
+	output, err := lima.ExecLimaVMWithOutput(servers[0], command)
+	if err != nil {
+		return err
+	}
+
+	var result vaultInit
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		return fmt.Errorf("error parsing the output of vault operator init: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(initPath, []byte(output), 0600); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, VaultRootTokenFile), []byte(result.RootToken), 0600); err != nil {
+		return err
+	}
+
+	fmt.Printf("Vault initialized on %s. The unseal keys and root token are stored in %s\n", servers[0], initPath)
+
+	return nil
+}
+
+// VaultUnseal unseals Vault on all the running servers of the cluster using
+// the unseal keys stored by VaultInit.
+func (c ShikariCluster) VaultUnseal(opts VaultOpts) error {
+	dir, err := StateDir(c.Name)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, VaultInitFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no unseal keys found for cluster %s, run vault init first", c.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	var keys vaultInit
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return fmt.Errorf("error reading the unseal keys: %w", err)
+	}
+
+	if keys.UnsealThreshold > len(keys.UnsealKeysB64) {
+		return fmt.Errorf("not enough unseal keys stored for cluster %s", c.Name)
+	}
+
+	var errs []error
+
+	for _, vmName := range c.runningServers() {
+		if err := unsealVault(vmName, keys.UnsealKeysB64[:keys.UnsealThreshold], opts); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		fmt.Printf("Vault unsealed on %s\n", vmName)
+	}
+
+	return errors.Join(errs...)
+}
+
+func unsealVault(vmName string, keys []string, opts VaultOpts) error {
+	for _, key := range keys {
+		command := fmt.Sprintf("%s vault operator unseal -format=json %s", opts.vaultEnv(), lima.ShellQuote(key))
+
+		if _, err := lima.ExecLimaVMWithOutput(vmName, command); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// VaultStatus returns the status of Vault on all the running servers of the cluster
+func (c ShikariCluster) VaultStatus(opts VaultOpts) ([]VaultStatus, error) {
+	var statuses []VaultStatus
+
+	for _, vmName := range c.runningServers() {
+		// vault status exits with 2 when sealed, the output is still valid
+		output, _ := lima.ExecLimaVMWithOutput(vmName, fmt.Sprintf("%s vault status -format=json", opts.vaultEnv()))
+
+		status := VaultStatus{VMName: vmName}
+
+		if err := json.Unmarshal([]byte(output), &status); err != nil {
+			return statuses, fmt.Errorf("error reading the vault status of %s: %w", vmName, err)
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// vaultEnv returns the environment for the vault CLI inside the VMs
+func (o VaultOpts) vaultEnv() string {
+	if o.TLS {
+		return "VAULT_ADDR=https://127.0.0.1:8200 VAULT_SKIP_VERIFY=true"
+	}
+
+	return "VAULT_ADDR=http://127.0.0.1:8200"
+}
+
+// runningServers returns the names of the running servers of the cluster
+func (c ShikariCluster) runningServers() []string {
+	var names []string
+
+	instances := lima.GetInstancesByPrefix(fmt.Sprintf("%s-srv", c.Name))
+
+	for _, vm := range lima.GetInstancesByStatus(instances, "running") {
+		names = append(names, vm.Name)
+	}
+
+	return names
+}
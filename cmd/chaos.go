@@ -0,0 +1,294 @@
+/*
+Copyright © 2024 Ranjandas Athiyanathum Poyil thejranjan@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+	"github.com/ranjandas/shikari/app/shikari"
+	"github.com/spf13/cobra"
+)
+
+// chaosCmd represents the chaos command
+var chaosCmd = &cobra.Command{
+	Use:   "chaos",
+	Short: "Inject faults into the VMs of a cluster",
+	Long: `Inject faults into the VMs of a cluster, to rehearse failure scenarios.
+
+The VMs are picked with selectors: comma separated lists of all, servers,
+clients, zones, racks or VMs (eg: srv-02). Active faults are kept in the
+cluster state until healed.
+
+Example:
+
+$ shikari chaos partition -n murphy --between zone-a,zone-b
+$ shikari chaos latency -n murphy --target srv-02 --delay 200ms
+$ shikari chaos status -n murphy
+$ shikari chaos heal -n murphy`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if len(lima.GetInstancesByPrefix(cluster.Name)) == 0 {
+			fmt.Printf("Cluster \"%s\" not found.\n", cluster.Name)
+			os.Exit(1)
+		}
+	},
+}
+
+var chaosPartitionCmd = &cobra.Command{
+	Use:   "partition",
+	Short: "Drop the network traffic between two sets of VMs",
+	Long: `Drop the network traffic between two sets of VMs, given with --between as
+two selector terms separated by a comma. VMs matching both sides stay on the
+first one, so --between srv-01,all isolates srv-01 from the rest of the cluster.
+
+Sides made of several terms are given with two --side flags instead, as the
+terms of a selector are also separated by commas:
+
+$ shikari chaos partition -n murphy --side srv-01,srv-02 --side zone-b`,
+	Run: func(cmd *cobra.Command, args []string) {
+		sides, _ := cmd.Flags().GetStringArray("side")
+
+		if between, _ := cmd.Flags().GetString("between"); between != "" {
+			sides = strings.Split(between, ",")
+		}
+
+		printFault(cluster.Partition(sides))
+	},
+}
+
+var chaosLatencyCmd = &cobra.Command{
+	Use:   "latency",
+	Short: "Delay the network traffic sent by VMs",
+	Run: func(cmd *cobra.Command, args []string) {
+		target, _ := cmd.Flags().GetString("target")
+		delay, _ := cmd.Flags().GetDuration("delay")
+		jitter, _ := cmd.Flags().GetDuration("jitter")
+
+		printFault(cluster.Latency(target, delay, jitter))
+	},
+}
+
+var chaosLossCmd = &cobra.Command{
+	Use:   "loss",
+	Short: "Drop a percentage of the network packets sent by VMs",
+	Run: func(cmd *cobra.Command, args []string) {
+		target, _ := cmd.Flags().GetString("target")
+		percent, _ := cmd.Flags().GetFloat64("percent")
+
+		printFault(cluster.Loss(target, percent))
+	},
+}
+
+var chaosStressCmd = &cobra.Command{
+	Use:   "stress",
+	Short: "Exhaust the CPU, memory or disk of VMs for a while",
+	Long: `Run stress workloads inside VMs for a duration, using stress-ng when it is
+installed and falling back to yes, tail and fallocate otherwise. The workloads
+are cleaned up after the duration, or when the fault is healed.
+
+Example:
+
+$ shikari chaos stress -n murphy --target clients --cpu 2 --memory 80% --disk-fill 90% --duration 5m`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := shikari.StressOpts{}
+
+		opts.Target, _ = cmd.Flags().GetString("target")
+		opts.CPU, _ = cmd.Flags().GetInt("cpu")
+		opts.Memory, _ = cmd.Flags().GetString("memory")
+		opts.DiskFill, _ = cmd.Flags().GetString("disk-fill")
+		opts.Duration, _ = cmd.Flags().GetDuration("duration")
+
+		printFault(cluster.Stress(opts))
+	},
+}
+
+var chaosClockCmd = &cobra.Command{
+	Use:   "clock",
+	Short: "Skew the system clock of VMs",
+	Long: `Offset the system clock of VMs, stopping their time synchronization while
+skewed. The clock is restored when the fault is healed, or after the duration.
+
+Example:
+
+$ shikari chaos clock -n murphy --target srv-02 --offset 5m
+$ shikari chaos clock -n murphy --target zone-b --offset=-90s --duration 10m`,
+	Run: func(cmd *cobra.Command, args []string) {
+		target, _ := cmd.Flags().GetString("target")
+		offset, _ := cmd.Flags().GetDuration("offset")
+		duration, _ := cmd.Flags().GetDuration("duration")
+
+		printFault(cluster.Clock(target, offset, duration))
+	},
+}
+
+var chaosKillCmd = &cobra.Command{
+	Use:   "kill",
+	Short: "Stop random or selected VMs, optionally restarting them",
+	Long: `Stop random running VMs matching the target, optionally starting them again
+after a delay.
+
+With --interval, VMs are killed repeatedly (and must be restarted), never
+taking down more servers than the cluster tolerates: (N-1)/2 for N servers.
+Every action is logged, including to chaos.log in the cluster state directory.
+
+Example:
+
+$ shikari chaos kill -n murphy --target srv-02 --force
+$ shikari chaos kill -n murphy --target all --interval 5m --restart-after 1m`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := shikari.KillOpts{}
+
+		opts.Target, _ = cmd.Flags().GetString("target")
+		opts.Count, _ = cmd.Flags().GetInt("count")
+		opts.Force, _ = cmd.Flags().GetBool("force")
+		opts.RestartAfter, _ = cmd.Flags().GetDuration("restart-after")
+		opts.Interval, _ = cmd.Flags().GetDuration("interval")
+		opts.Rounds, _ = cmd.Flags().GetInt("rounds")
+
+		if err := cluster.Kill(opts); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var chaosHealCmd = &cobra.Command{
+	Use:   "heal [fault id]",
+	Short: "Remove a fault, or all the faults of the cluster",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var id string
+		if len(args) > 0 {
+			id = args[0]
+		}
+
+		healed, err := cluster.Heal(id)
+
+		for _, f := range healed {
+			fmt.Printf("Fault %s healed on %s.\n", f.ID, strings.Join(f.Targets(), ","))
+		}
+
+		if err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var chaosStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List the faults of the cluster",
+	Long: `List the faults of the cluster. Faults that have reverted themselves
+are shown as expired until healed. VMs stopped or restarted since a fault was
+injected have lost it, and are listed as lost rather than affected.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		faults, err := cluster.ListFaults()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		vms := lima.GetInstancesByPrefix(cluster.Name)
+
+		w := tabwriter.NewWriter(os.Stdout, 4, 8, 4, byte(' '), 0)
+
+		if !noheader {
+			fmt.Fprintln(w, "ID\tKIND\tVMS\tLOST\tDETAILS\tSINCE\tUNTIL\tSTATE")
+		}
+
+		for _, f := range faults {
+			until := "-"
+			if f.ExpiresAt != nil {
+				until = f.ExpiresAt.Format(time.DateTime)
+			}
+
+			lost := f.LostOn(vms)
+			affected := slices.DeleteFunc(f.Targets(), func(vmName string) bool { return slices.Contains(lost, vmName) })
+
+			state := "active"
+			if f.Expired() {
+				state = "expired"
+			} else if len(affected) == 0 {
+				state = "healed"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", f.ID, f.Kind, joinOrDash(affected), joinOrDash(lost), f.Details, f.CreatedAt.Format(time.DateTime), until, state)
+		}
+		w.Flush()
+	},
+}
+
+// joinOrDash returns the comma separated names, or - when there are none
+func joinOrDash(names []string) string {
+	if len(names) == 0 {
+		return "-"
+	}
+
+	return strings.Join(names, ",")
+}
+
+func printFault(fault shikari.Fault, err error) {
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("Fault %s (%s) injected into %s.\n", fault.ID, fault.Details, strings.Join(fault.Targets(), ","))
+}
+
+func init() {
+	rootCmd.AddCommand(chaosCmd)
+	chaosCmd.AddCommand(chaosPartitionCmd)
+	chaosCmd.AddCommand(chaosLatencyCmd)
+	chaosCmd.AddCommand(chaosLossCmd)
+	chaosCmd.AddCommand(chaosStressCmd)
+	chaosCmd.AddCommand(chaosClockCmd)
+	chaosCmd.AddCommand(chaosKillCmd)
+	chaosCmd.AddCommand(chaosHealCmd)
+	chaosCmd.AddCommand(chaosStatusCmd)
+
+	chaosCmd.PersistentFlags().StringVarP(&cluster.Name, "name", "n", "", "name of the cluster")
+	chaosCmd.MarkPersistentFlagRequired("name")
+
+	chaosPartitionCmd.Flags().String("between", "", "the two sides of the partition as selector terms, eg: zone-a,zone-b")
+	chaosPartitionCmd.Flags().StringArray("side", []string{}, "selector of a side of the partition, eg: srv-01,cli-01 (used twice, instead of --between)")
+	chaosPartitionCmd.MarkFlagsOneRequired("between", "side")
+	chaosPartitionCmd.MarkFlagsMutuallyExclusive("between", "side")
+
+	chaosLatencyCmd.Flags().String("target", "", "selector of the VMs to delay the traffic of, eg: srv-02")
+	chaosLatencyCmd.Flags().Duration("delay", 0, "delay added to the packets, eg: 200ms")
+	chaosLatencyCmd.Flags().Duration("jitter", 0, "random variation of the delay, eg: 20ms")
+	chaosLatencyCmd.MarkFlagRequired("target")
+	chaosLatencyCmd.MarkFlagRequired("delay")
+
+	chaosLossCmd.Flags().String("target", "", "selector of the VMs to drop the packets of, eg: clients")
+	chaosLossCmd.Flags().Float64("percent", 0, "percentage of the packets to drop, eg: 10")
+	chaosLossCmd.MarkFlagRequired("target")
+	chaosLossCmd.MarkFlagRequired("percent")
+
+	chaosStressCmd.Flags().String("target", "", "selector of the VMs to stress, eg: clients")
+	chaosStressCmd.Flags().Int("cpu", 0, "number of CPU workers")
+	chaosStressCmd.Flags().String("memory", "", "percentage of the memory to use, eg: 80%")
+	chaosStressCmd.Flags().String("disk-fill", "", "percentage of the root filesystem to fill, eg: 90%")
+	chaosStressCmd.Flags().Duration("duration", 5*time.Minute, "how long the stress lasts")
+	chaosStressCmd.MarkFlagRequired("target")
+
+	chaosClockCmd.Flags().String("target", "", "selector of the VMs to skew the clock of, eg: srv-02")
+	chaosClockCmd.Flags().Duration("offset", 0, "offset added to the clock, negative to set it back (eg: 5m or -30s)")
+	chaosClockCmd.Flags().Duration("duration", 0, "restore the clock after the duration (default until healed)")
+	chaosClockCmd.MarkFlagRequired("target")
+	chaosClockCmd.MarkFlagRequired("offset")
+
+	chaosKillCmd.Flags().String("target", "all", "selector of the VMs that can be killed, eg: clients or zone-a")
+	chaosKillCmd.Flags().Int("count", 1, "number of VMs to kill at once")
+	chaosKillCmd.Flags().BoolP("force", "f", false, "force stop the VMs instead of shutting them down")
+	chaosKillCmd.Flags().Duration("restart-after", 0, "start the VMs again after the delay, eg: 30s")
+	chaosKillCmd.Flags().Duration("interval", 0, "kill VMs repeatedly at the interval, eg: 5m")
+	chaosKillCmd.Flags().Int("rounds", 0, "number of repeated kills with --interval (default until interrupted)")
+
+	chaosStatusCmd.Flags().BoolVarP(&noheader, "no-header", "", false, "skip the header from list output")
+}
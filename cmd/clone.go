@@ -0,0 +1,48 @@
+/*
+Copyright © 2024 Ranjandas Athiyanathum Poyil thejranjan@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+	"github.com/spf13/cobra"
+)
+
+// cloneCmd represents the clone command
+var cloneCmd = &cobra.Command{
+	Use:   "clone",
+	Short: "Clones an existing cluster into a new cluster",
+	Long: `Clones every VM of an existing cluster into a new cluster, so a prepared
+environment can be forked without provisioning it again. The VMs of the source
+cluster are stopped while they are cloned and started again afterwards.
+
+Example:
+
+$ shikari clone -n murphy --to murphy2 --start`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(lima.GetInstancesByPrefix(cluster.Name)) == 0 {
+			fmt.Printf("Cluster \"%s\" not found.\n", cluster.Name)
+			return
+		}
+
+		if err := cluster.Clone(cloneTo, cloneStart); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var cloneTo string
+var cloneStart bool
+
+func init() {
+	rootCmd.AddCommand(cloneCmd)
+
+	cloneCmd.Flags().StringVarP(&cluster.Name, "name", "n", "", "name of the cluster to clone")
+	cloneCmd.Flags().StringVar(&cloneTo, "to", "", "name of the new cluster")
+	cloneCmd.Flags().BoolVar(&cloneStart, "start", false, "start the VMs of the new cluster")
+
+	cloneCmd.MarkFlagRequired("name")
+	cloneCmd.MarkFlagRequired("to")
+}
@@ -18,12 +18,12 @@ var createCmd = &cobra.Command{
 
 For example:
 
-$ shikari create --name murphy --servers 3  --clients 3 --template hashibox --env CONSUL_LICENSE=$(cat consul.hclic)
+$ shikari create --name murphy --servers 3  --clients 3 --template hashibox --secret CONSUL_LICENSE=@consul.hclic
 
 The above command will create a 3 server and 3 client cluster, each vm
 carrying the name as a prefix to easily identify.
 `,
-	PreRunE: loadLicenses,
+	PreRunE: loadEnvVars,
 	Run: func(cmd *cobra.Command, args []string) {
 		if len(lima.GetInstancesByPrefix(cluster.Name)) > 0 {
 			fmt.Printf("Cluster %s alredy exist!", cluster.Name)
@@ -41,9 +41,21 @@ func init() {
 	createCmd.Flags().StringVarP(&cluster.Name, "name", "n", "", "name of the cluster")
 	createCmd.Flags().StringVarP(&cluster.Arch, "arch", "a", "aarch64", "the architecture of the VM (supported by Lima). Eg: aarch64, s390x")
 	createCmd.Flags().StringVarP(&cluster.Template, "template", "t", "./hashibox.yaml", "name of lima template for the VMs")
-	createCmd.Flags().StringSliceVarP(&cluster.EnvVars, "env", "e", []string{}, "provide environment vars in the for key=value (can be used multiple times)")
+	createCmd.Flags().StringArrayVarP(&cluster.EnvVars, "env", "e", []string{}, "provide environment vars in the form key=value, or key=@path to read the value from a file (can be used multiple times)")
+	createCmd.Flags().StringArrayVar(&cluster.NodeEnvVars, "env-for", []string{}, "override environment vars per role or VM in the form servers|clients|srv-NN|cli-NN:key=value (can be used multiple times)")
+	createCmd.Flags().StringArrayVar(&envFiles, "env-file", []string{}, "read environment vars from a dotenv file (can be used multiple times)")
+	createCmd.Flags().StringArrayVar(&passEnv, "pass-env", []string{}, "pass the environment var with the given name from the host (can be used multiple times)")
+	createCmd.Flags().StringArrayVar(&cluster.Secrets, "secret", []string{}, "provide secrets in the form key=value or key=@path, copied into the VMs as files exposed through key_PATH (can be used multiple times)")
 	createCmd.Flags().StringVarP(&cluster.ImgPath, "image", "i", "", "path to the cqow2 images to be used for the VMs, overriding the one in the template")
 
+	createCmd.Flags().BoolVar(&cluster.PKI, "pki", false, "create a CA on the host and issue the TLS certificates of the VMs from it")
+
+	createCmd.Flags().StringVar(&cluster.ConsulGossipKey, "consul-gossip-key", "", "Consul gossip encryption key (generated when not given)")
+	createCmd.Flags().StringVar(&cluster.NomadGossipKey, "nomad-gossip-key", "", "Nomad gossip encryption key (generated when not given)")
+
+	createCmd.Flags().StringVar(&cluster.Zones, "zones", "", "spread the VMs round-robin over zones, given as a count (zone-a, zone-b...) or comma separated names")
+	createCmd.Flags().StringVar(&cluster.Racks, "racks", "", "spread the VMs of each zone round-robin over racks, given as a count (rack-1, rack-2...) or comma separated names")
+
 	createCmd.MarkFlagRequired("name")
 	createCmd.MarkFlagRequired("servers")
 }
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	lima "github.com/ranjandas/shikari/app/lima"
+	"github.com/ranjandas/shikari/app/shikari"
 	"github.com/spf13/cobra"
 )
 
@@ -33,6 +34,7 @@ var destroyCmd = &cobra.Command{
 
 		if cluster.Force {
 			destroyVM(allInstances, true)
+			cleanupCluster(cluster.Name)
 			return
 		}
 
@@ -45,6 +47,7 @@ var destroyCmd = &cobra.Command{
 		stoppedInstances := lima.GetInstancesByStatus(allInstances, "stopped")
 		if len(allInstances) == len(stoppedInstances) {
 			destroyVM(allInstances, false)
+			cleanupCluster(cluster.Name)
 		}
 	},
 }
@@ -80,3 +83,14 @@ func destroyVM(instances []lima.LimaVM, force bool) {
 		fmt.Println(err)
 	}
 }
+
+// cleanupCluster removes the state of the cluster and its kubeconfig context once all its VMs are gone
+func cleanupCluster(clusterName string) {
+	if len(lima.GetInstancesByPrefix(clusterName)) > 0 {
+		return
+	}
+
+	if err := shikari.ClearState(clusterName); err != nil {
+		fmt.Printf("error cleaning up cluster %s: %v\n", clusterName, err)
+	}
+}
@@ -4,19 +4,21 @@ Copyright © 2024 Ranjandas Athiyanathum Poyil thejranjan@gmail.com
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
-	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
 	lima "github.com/ranjandas/shikari/app/lima"
+	"github.com/ranjandas/shikari/app/shikari"
 	"github.com/spf13/cobra"
 )
 
-var validProducts = []string{"consul", "nomad", "vault", "boundary", "k3s"}
-
 // envCmd represents the env command
 var envCmd = &cobra.Command{
 	Use:   "env",
@@ -29,7 +31,18 @@ shikari env -n murphy -t consul,nomad
 export CONSUL_HTTP_ADDR=https://xxx.xxx
 export CONSUL_CACERT=xxx/consul-agent-ca.pem
 export NOMAD_ADDR=https://xxx.xxx
-export NOMAD_CACERT=xxx/nomad-agent-ca.pem`,
+export NOMAD_CACERT=xxx/nomad-agent-ca.pem
+
+Besides the built-in products (consul, nomad, vault, boundary and k3s), products
+can be defined in YAML files in ~/.shikari/products/, for example:
+
+name: waypoint
+addr_var: WAYPOINT_ADDR
+port: 9701
+token:
+  var: WAYPOINT_TOKEN
+cacert_var: WAYPOINT_CACERT
+insecure_var: WAYPOINT_TLS_SKIP_VERIFY`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		if len(lima.GetInstancesByPrefix(cluster.Name)) == 0 {
@@ -37,22 +50,44 @@ export NOMAD_CACERT=xxx/nomad-agent-ca.pem`,
 			return
 		}
 
+		products, err := shikari.LoadProducts()
+		if err != nil {
+			fmt.Println("Error loading product definitions:", err)
+			return
+		}
+
 		if !(len(args) > 0) {
-			fmt.Println("No product name passed as argument. Supported product names", validProducts)
+			fmt.Println("No product name passed as argument. Supported product names", validProducts(products))
 			return
 		}
 		// Set ClientConfig Name same as Cluster Name
 		// TODO: Refcator the flags by unifying common flags
 		clientConfigOpts.Name = cluster.Name
-		products := args[0]
 
-		for _, product := range strings.Split(products, ",") {
-			if isValidProduct(product) {
-				clientConfigOpts.printClientConfigEnvs(product)
+		if !slices.Contains(validShells, clientConfigOpts.Shell) {
+			fmt.Println("Invalid shell", clientConfigOpts.Shell, "Supported shells", validShells)
+			return
+		}
+
+		if clientConfigOpts.Shell == "dotenv" && clientConfigOpts.Unset {
+			fmt.Println("A dotenv file cannot unset variables, --unset cannot be used with --shell dotenv")
+			return
+		}
+
+		var vars []envVar
+
+		for _, product := range strings.Split(args[0], ",") {
+			if p, ok := products[product]; ok {
+				vars = append(vars, clientConfigOpts.getProductVariables(p)...)
+			} else if product == "k3s" {
+				vars = append(vars, clientConfigOpts.getK3SVariables()...)
 			} else {
-				fmt.Println("\nInvalid product name", product)
+				// stderr, to keep the output consumable by the shell
+				fmt.Fprintln(os.Stderr, "Invalid product name", product)
 			}
 		}
+
+		fmt.Println(formatEnvVars(vars, clientConfigOpts.Shell, clientConfigOpts.Unset))
 	},
 }
 
@@ -65,6 +100,14 @@ func init() {
 	envCmd.Flags().BoolVarP(&clientConfigOpts.Insecure, "insecure", "i", false, "prints the skip TLS Verify variables")
 	envCmd.Flags().BoolVarP(&clientConfigOpts.Unset, "unset", "u", false, "unset the variables insetad of export")
 
+	envCmd.Flags().StringVar(&clientConfigOpts.Shell, "shell", "bash", fmt.Sprintf("format of the output: %s", strings.Join(validShells, ", ")))
+	envCmd.Flags().StringVarP(&clientConfigOpts.Server, "server", "s", shikari.ServerLeader, "server to point at: leader, first, random or an instance name (eg: srv-02)")
+
+	envCmd.Flags().BoolVar(&clientConfigOpts.ViaProxy, "via-proxy", false, "point at the local proxy started with \"shikari proxy\"")
+	envCmd.Flags().StringVar(&clientConfigOpts.ProxyAddr, "proxy-addr", "127.0.0.1", "address the proxy is reached at with --via-proxy (eg: the --bind address of the proxy)")
+
+	envCmd.Flags().BoolVar(&clientConfigOpts.MergeKubeConfig, "merge-kubeconfig", false, "merge the k3s kubeconfig into $KUBECONFIG (or ~/.kube/config) under the context shikari-<cluster>")
+
 	envCmd.MarkFlagRequired("name")
 }
 
@@ -74,249 +117,368 @@ type ClientConfigOpts struct {
 	ACL      bool
 	Insecure bool
 	Unset    bool
+	Server   string // server selection strategy or instance name
+	ViaProxy bool
+	Shell    string // dialect of the output
+
+	ProxyAddr string // address of the proxy with ViaProxy
+
+	MergeKubeConfig bool
 }
 
 var clientConfigOpts ClientConfigOpts
 
-func isValidProduct(product string) bool {
-	for _, p := range validProducts {
-		if product == p {
-			return true
+// envVar is an environment variable to be exported (or unset) in the shell
+type envVar struct {
+	Name  string
+	Value string
+}
+
+// validProducts returns the names of the products supported by env
+func validProducts(products map[string]shikari.Product) []string {
+	return append(shikari.ProductNames(products), "k3s")
+}
+
+var validShells = []string{"bash", "zsh", "fish", "powershell", "dotenv", "json"}
+
+// safeShellValue matches the values that need no quoting in any of the shells
+var safeShellValue = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]*$`)
+
+// formatEnvVars renders the variables as commands of the shell (or as a dotenv
+// file or JSON object) exporting them, or unsetting them when unset is set.
+// A dotenv file cannot unset variables, so they are left out.
+func formatEnvVars(vars []envVar, shell string, unset bool) string {
+	if shell == "json" {
+		obj := make(map[string]*string)
+
+		for _, v := range vars {
+			obj[v.Name] = nil // null unsets the variable
+
+			if !unset {
+				value := v.Value
+				obj[v.Name] = &value
+			}
+		}
+
+		out, _ := json.MarshalIndent(obj, "", "  ")
+
+		return string(out)
+	}
+
+	var lines []string
+
+	for _, v := range vars {
+		var line string
+
+		switch {
+		case shell == "fish" && unset:
+			line = fmt.Sprintf("set -e %s", v.Name)
+		case shell == "fish":
+			line = fmt.Sprintf("set -gx %s %s", v.Name, quotePosix(v.Value))
+		case shell == "powershell" && unset:
+			line = fmt.Sprintf("Remove-Item Env:%s -ErrorAction SilentlyContinue", v.Name)
+		case shell == "powershell":
+			line = fmt.Sprintf("$Env:%s = '%s'", v.Name, strings.ReplaceAll(v.Value, "'", "''"))
+		case shell == "dotenv" && unset:
+			continue // an empty value would set the variable
+		case shell == "dotenv":
+			line = fmt.Sprintf("%s=%s", v.Name, quoteDotenv(v.Value))
+		case unset:
+			line = fmt.Sprintf("unset %s", v.Name)
+		default:
+			line = fmt.Sprintf("export %s=%s", v.Name, quotePosix(v.Value))
 		}
+
+		lines = append(lines, line)
 	}
-	return false
+
+	return strings.Join(lines, "\n")
 }
 
-func (c ClientConfigOpts) printClientConfigEnvs(product string) {
-	switch product {
-	case "consul":
-		fmt.Println(c.getConsulVariables())
-	case "nomad":
-		fmt.Println(c.getNomadVariables())
-	case "vault":
-		fmt.Println(c.getVaultVariables())
-	case "boundary":
-		fmt.Println(c.getBoundaryVariables())
-	case "k3s":
-		fmt.Println(c.getK3SVariables())
+// quotePosix single quotes the value when needed, which also works for fish
+func quotePosix(value string) string {
+	if safeShellValue.MatchString(value) {
+		return value
 	}
+
+	return lima.ShellQuote(value)
 }
 
-func (c ClientConfigOpts) getRandomServer() lima.LimaVM {
-	// always get the instances of type server "-srv"
-	instances := lima.GetInstancesByPrefix(fmt.Sprintf("%s-srv", c.Name))
-	runningInstances := lima.GetInstancesByStatus(instances, "running")
+func quoteDotenv(value string) string {
+	if safeShellValue.MatchString(value) {
+		return value
+	}
+
+	return strconv.Quote(value)
+}
 
-	if !(len(runningInstances) > 0) {
+// getServer returns the server the variables point at, exiting when there is none
+func (c ClientConfigOpts) getServer(p *shikari.Product) lima.LimaVM {
+	vm, err := shikari.ShikariCluster{Name: c.Name}.SelectServer(c.Server, p)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
 		os.Exit(1)
 	}
 
-	randomIndex := rand.Intn(len(runningInstances))
-	return runningInstances[randomIndex]
+	return vm
 }
 
-func (c ClientConfigOpts) getConsulVariables() string {
+func (c ClientConfigOpts) getProductVariables(p shikari.Product) []envVar {
 
 	if c.Unset {
-		return "unset CONSUL_HTTP_ADDR\nunset CONSUL_HTTP_TOKEN\nunset CONSUL_HTTP_SSL_VERIFY\nunset CONSUL_CACERT"
+		vars := []envVar{{Name: p.AddrVar}}
+
+		for _, name := range []string{p.Token.Var, p.InsecureVar, p.CACertVar, p.TLSServerNameVar} {
+			if name != "" {
+				vars = append(vars, envVar{Name: name})
+			}
+		}
+
+		return vars
 	}
 
-	addr := c.getRandomServer().GetIPAddress()
+	addr := c.ProxyAddr // shikari proxy
+
+	if !c.ViaProxy {
+		addr = c.getServer(&p).GetIPAddress()
+	}
 	scheme := "http://"
-	port := 8500
-	bootstrapToken := "root" // consul bootstrap token
-	caCertVar := ""
+	port := p.Port
 
 	if c.TLS {
 		scheme = "https://"
-		port = 8501
-		caCertVar = fmt.Sprintf("export CONSUL_CACERT=%s", c.getTLSCaCertPath("consul"))
+		port = p.TLSPort
 	}
 
-	consulHTTPAddr := fmt.Sprintf("%s%s:%d", scheme, addr, port)
+	vars := []envVar{{Name: p.AddrVar, Value: fmt.Sprintf("%s%s:%d", scheme, addr, port)}}
 
-	// env-variable=value
-	httpAddrVar := fmt.Sprintf("export CONSUL_HTTP_ADDR=%s", consulHTTPAddr)
-	tokenVar := fmt.Sprintf("export CONSUL_HTTP_TOKEN=%s", bootstrapToken)
-	insecureTLSVar := "export CONSUL_HTTP_SSL_VERIFY=false"
+	if c.TLS && p.CACertVar != "" {
+		vars = append(vars, envVar{Name: p.CACertVar, Value: c.getTLSCaCertPath(p)})
+	}
 
-	combinedVars := httpAddrVar
+	if c.TLS && p.TLSServerNameVar != "" && c.usesHostPKI() {
+		serverName, err := p.RenderTLSServerName(c.Name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 
-	if c.TLS {
-		combinedVars = strings.Join([]string{combinedVars, caCertVar}, "\n")
+		vars = append(vars, envVar{Name: p.TLSServerNameVar, Value: serverName})
 	}
 
-	if c.ACL {
-		combinedVars = strings.Join([]string{combinedVars, tokenVar}, "\n")
+	if c.ACL && p.Token.Var != "" {
+		if token := c.getBootstrapToken(p); token != "" {
+			vars = append(vars, envVar{Name: p.Token.Var, Value: token})
+		}
 	}
 
-	if c.Insecure {
-		combinedVars = strings.Join([]string{combinedVars, insecureTLSVar}, "\n")
+	if c.Insecure && p.InsecureVar != "" {
+		vars = append(vars, envVar{Name: p.InsecureVar, Value: p.InsecureValue})
 	}
 
-	return combinedVars
+	return vars
 }
 
-func (c ClientConfigOpts) getNomadVariables() string {
+func (c ClientConfigOpts) getK3SVariables() []envVar {
 
 	if c.Unset {
-		return "unset NOMAD_ADDR\nunset NOMAD_TOKEN\nunset NOMAD_SKIP_VERIFY\nunset NOMAD_CACERT"
+		return []envVar{{Name: "KUBECONFIG"}}
 	}
 
-	addr := c.getRandomServer().GetIPAddress()
-	scheme := "http://"
-	port := 4646
-	bootstrapToken := "00000000-0000-0000-0000-000000000000" // consul bootstrap token
-	caCertVar := ""
+	vm := lima.GetInstance(fmt.Sprintf("%s-srv-01", c.Name))
 
-	if c.TLS {
-		scheme = "https://"
-		caCertVar = fmt.Sprintf("export NOMAD_CACERT=%s", c.getTLSCaCertPath("nomad"))
+	if vm.Name == "" {
+		return nil //There are no VMs in the cluster
 	}
 
-	nomadHTTPAddr := fmt.Sprintf("%s%s:%d", scheme, addr, port)
-
-	// env-variable=value
-	httpAddrVar := fmt.Sprintf("export NOMAD_ADDR=%s", nomadHTTPAddr)
-	tokenVar := fmt.Sprintf("export NOMAD_TOKEN=%s", bootstrapToken)
-	insecureTLSVar := "export NOMAD_SKIP_VERIFY=true"
+	err := c.copyK3SKubeConfig()
+	if err != nil {
+		fmt.Printf("error copying KUBECONFIG for Cluster: %s %v\n", c.Name, err)
+		os.Exit(1)
+	}
 
-	combinedVars := httpAddrVar
+	k3sKubeConfig := filepath.Join(vm.Dir, "k3s.yaml")
 
-	if c.TLS {
-		combinedVars = strings.Join([]string{combinedVars, caCertVar}, "\n")
-	}
+	if c.MergeKubeConfig {
+		if err := shikari.MergeKubeConfig(c.Name, k3sKubeConfig, vm.GetIPAddress()); err != nil {
+			fmt.Fprintf(os.Stderr, "error merging KUBECONFIG for Cluster: %s %v\n", c.Name, err)
+			os.Exit(1)
+		}
 
-	if c.ACL {
-		combinedVars = strings.Join([]string{combinedVars, tokenVar}, "\n")
-	}
+		fmt.Fprintf(os.Stderr, "Merged context \"%s\" into the default kubeconfig and set it as the current context\n", shikari.KubeContextName(c.Name))
 
-	if c.Insecure {
-		combinedVars = strings.Join([]string{combinedVars, insecureTLSVar}, "\n")
+		return nil // kubectl uses the default kubeconfig
 	}
 
-	return combinedVars
+	return []envVar{{Name: "KUBECONFIG", Value: k3sKubeConfig}}
 }
 
-func (c ClientConfigOpts) getVaultVariables() string {
+func (c ClientConfigOpts) copyK3SKubeConfig() error {
 
-	if c.Unset {
-		return "unset VAULT_ADDR\nunset VAULT_SKIP_VERIFY\nunset VAULT_CACERT"
-	}
+	vm := lima.GetInstance(fmt.Sprintf("%s-srv-01", c.Name))
 
-	addr := c.getRandomServer().GetIPAddress()
-	scheme := "http://"
-	port := 8200
-	caCertVar := ""
+	cmd := exec.Command("/bin/sh", "-c", fmt.Sprintf("limactl copy %s:/etc/rancher/k3s/k3s.yaml %s", vm.Name, vm.Dir))
 
-	if c.TLS {
-		scheme = "https://"
-		caCertVar = fmt.Sprintf("export VAULT_CACERT=%s", c.getTLSCaCertPath("vault"))
+	// Run the command
+	err := cmd.Run()
+	if err != nil {
+		return err
 	}
 
-	vaultHTTPAddr := fmt.Sprintf("%s%s:%d", scheme, addr, port)
+	// Set 0600 permission as a best practice
+	filepath := filepath.Join(vm.Dir, "k3s.yaml")
+
+	err = os.Chmod(filepath, 0600)
 
-	// env-variable=value
-	httpAddrVar := fmt.Sprintf("export VAULT_ADDR=%s", vaultHTTPAddr)
-	insecureTLSVar := "export VAULT_SKIP_VERIFY=true"
+	return err
+}
 
-	combinedVars := httpAddrVar
+// getBootstrapToken returns the management token of the product read from the
+// first server, falling back to the default token of the product.
+func (c ClientConfigOpts) getBootstrapToken(p shikari.Product) string {
+	vm, ok := shikari.ShikariCluster{Name: c.Name}.FirstServer()
 
-	if c.TLS {
-		combinedVars = strings.Join([]string{combinedVars, caCertVar}, "\n")
+	if !ok {
+		return defaultBootstrapToken(p, fmt.Sprintf("no servers in the cluster %s", c.Name))
 	}
 
-	if c.Insecure {
-		combinedVars = strings.Join([]string{combinedVars, insecureTLSVar}, "\n")
+	if p.Token.HostPath != "" {
+		path, err := p.RenderTokenHostPath(c.Name, vm.GetVMDir())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if token, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(token))) > 0 {
+			return strings.TrimSpace(string(token))
+		}
 	}
 
-	return combinedVars
-}
+	if token := copyBootstrapToken(vm, p); token != "" {
+		return token
+	}
 
-func (c ClientConfigOpts) getBoundaryVariables() string {
-	// ref: https://developer.hashicorp.com/boundary/docs/commands#environment-variables
+	if p.Token.GuestCommand != "" && vm.Status == "Running" {
+		output, err := lima.ExecLimaVMWithOutput(vm.Name, p.Token.GuestCommand)
+		if token := strings.TrimSpace(output); err == nil && token != "" {
+			return token
+		}
+	}
 
-	if c.Unset {
-		return "unset BOUNDARY_ADDR\nunset BOUNDARY_TLS_INSECURE\nunset BOUNDARY_CACERT"
+	return defaultBootstrapToken(p, fmt.Sprintf("no token found on %s", vm.Name))
+}
+
+// defaultBootstrapToken returns the default token of the product, warning that
+// it is used when the product has a token to read from the cluster
+func defaultBootstrapToken(p shikari.Product, reason string) string {
+	if p.Token.HostPath != "" || p.Token.GuestPath != "" || p.Token.GuestCommand != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s, using the default %s token\n", reason, p.Name)
 	}
 
-	addr := c.getRandomServer().GetIPAddress()
-	scheme := "http://"
-	port := 9200
-	caCertVar := ""
+	return p.Token.Value
+}
 
-	if c.TLS {
-		scheme = "https://"
-		caCertVar = fmt.Sprintf("export BOUNDARY_CACERT=%s", c.getTLSCaCertPath("boundary"))
+// copyBootstrapToken copies the token file of the product from the guest into
+// the copied-from-guest directory of the VM, and returns the copied token. A
+// token copied earlier is returned when the VM is not running.
+func copyBootstrapToken(vm lima.LimaVM, p shikari.Product) string {
+	if p.Token.GuestPath == "" {
+		return ""
 	}
 
-	boundaryHTTPAddr := fmt.Sprintf("%s%s:%d", scheme, addr, port)
+	copiedDir := filepath.Join(vm.GetVMDir(), "copied-from-guest")
+	tokenPath := filepath.Join(copiedDir, fmt.Sprintf("%s-bootstrap-token", p.Name))
 
-	// env-variable=value
-	httpAddrVar := fmt.Sprintf("export BOUNDARY_ADDR=%s", boundaryHTTPAddr)
-	insecureTLSVar := "export BOUNDARY_TLS_INSECURE=true"
+	if vm.Status == "Running" {
+		// The token files are usually readable only by root, hence not using limactl copy
+		output, err := lima.ExecLimaVMWithOutput(vm.Name, fmt.Sprintf("sudo cat %s 2>/dev/null", lima.ShellQuote(p.Token.GuestPath)))
 
-	combinedVars := httpAddrVar
+		if token := strings.TrimSpace(output); err == nil && token != "" {
+			if err := os.MkdirAll(copiedDir, 0700); err == nil {
+				// Set 0600 permission as a best practice
+				os.WriteFile(tokenPath, []byte(token), 0600)
+			}
 
-	if c.TLS {
-		combinedVars = strings.Join([]string{combinedVars, caCertVar}, "\n")
+			return token
+		}
 	}
 
-	if c.Insecure {
-		combinedVars = strings.Join([]string{combinedVars, insecureTLSVar}, "\n")
+	token, err := os.ReadFile(tokenPath)
+	if err != nil {
+		return ""
 	}
 
-	return combinedVars
+	return strings.TrimSpace(string(token))
 }
 
-func (c ClientConfigOpts) getK3SVariables() string {
-	var k3sKubeConfig string
+// usesHostPKI reports whether the certificates of the cluster are issued by the host-side PKI
+func (c ClientConfigOpts) usesHostPKI() bool {
+	state, err := shikari.LoadState(c.Name)
 
-	vm := lima.GetInstance(fmt.Sprintf("%s-srv-01", c.Name))
+	return err == nil && state.PKI
+}
 
-	if vm.Name == "" {
-		return "" //There are no VMs in the cluster
+func (c ClientConfigOpts) getTLSCaCertPath(p shikari.Product) string {
+	if c.usesHostPKI() {
+		path, err := shikari.CACertPath(c.Name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		return path
 	}
 
-	err := c.copyK3SKubeConfig()
-	if err != nil {
-		fmt.Printf("error copying KUBECONFIG for Cluster: %s %v\n", c.Name, err)
+	servers := shikari.ShikariCluster{Name: c.Name}.Servers()
+
+	if len(servers) == 0 {
+		fmt.Fprintf(os.Stderr, "No servers in the cluster %s to find the %s CA certificate on\n", c.Name, p.Name)
 		os.Exit(1)
 	}
 
-	k3sKubeConfig = fmt.Sprintf("export KUBECONFIG=%s/k3s.yaml", vm.Dir)
+	var errs []string
 
-	return k3sKubeConfig
-}
+	// the first server having the CA certificate, copied to the host by the
+	// scenario or fetched from the guest
+	for _, vm := range servers {
+		path, err := p.RenderCAPath(c.Name, vm.GetVMDir())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 
-func (c ClientConfigOpts) copyK3SKubeConfig() error {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
 
-	vm := lima.GetInstance(fmt.Sprintf("%s-srv-01", c.Name))
+		guestPath, err := p.RenderCAGuestPath(c.Name, vm.GetVMDir())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 
-	cmd := exec.Command("/bin/sh", "-c", fmt.Sprintf("limactl copy %s:/etc/rancher/k3s/k3s.yaml %s", vm.Name, vm.Dir))
+		if err := copyCACert(vm, guestPath, path); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: not found at %s, and could not be fetched from %s: %v", vm.Name, path, guestPath, err))
+			continue
+		}
 
-	// Run the command
-	err := cmd.Run()
-	if err != nil {
-		return err
+		return path
 	}
 
-	// Set 0600 permission as a best practice
-	filepath := filepath.Join(vm.Dir, "k3s.yaml")
-
-	err = os.Chmod(filepath, 0600)
+	fmt.Fprintf(os.Stderr, "The %s CA certificate was not found on any server of the cluster %s:\n  %s\n", p.Name, c.Name, strings.Join(errs, "\n  "))
+	os.Exit(1)
 
-	return err
+	return ""
 }
 
-func (c ClientConfigOpts) getTLSCaCertPath(product string) string {
-	firstInstance := fmt.Sprintf("%s-srv-01", c.Name)
-
-	vm := lima.GetInstance(firstInstance)
+func copyCACert(vm lima.LimaVM, guestPath string, path string) error {
+	if vm.Status != "Running" {
+		return fmt.Errorf("instance %s is not running", vm.Name)
+	}
 
-	if vm.Name == "" {
-		return "" //There are no VMs in the cluster
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
 	}
 
-	return fmt.Sprintf("%s/copied-from-guest/%s-agent-ca.pem", vm.GetVMDir(), product)
+	return lima.CopyFromLimaVM(vm.Name, guestPath, path)
 }
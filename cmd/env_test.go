@@ -0,0 +1,41 @@
+package cmd
+
+import "testing"
+
+func TestFormatEnvVars(t *testing.T) {
+	vars := []envVar{
+		{Name: "NOMAD_ADDR", Value: "https://192.168.105.13:4646"},
+		{Name: "NOMAD_TOKEN", Value: "it's a $secret"},
+	}
+
+	tests := []struct {
+		shell string
+		unset bool
+		want  string
+	}{
+		{"bash", false, "export NOMAD_ADDR=https://192.168.105.13:4646\nexport NOMAD_TOKEN='it'\\''s a $secret'"},
+		{"bash", true, "unset NOMAD_ADDR\nunset NOMAD_TOKEN"},
+		{"zsh", false, "export NOMAD_ADDR=https://192.168.105.13:4646\nexport NOMAD_TOKEN='it'\\''s a $secret'"},
+		{"fish", false, "set -gx NOMAD_ADDR https://192.168.105.13:4646\nset -gx NOMAD_TOKEN 'it'\\''s a $secret'"},
+		{"fish", true, "set -e NOMAD_ADDR\nset -e NOMAD_TOKEN"},
+		{"powershell", false, "$Env:NOMAD_ADDR = 'https://192.168.105.13:4646'\n$Env:NOMAD_TOKEN = 'it''s a $secret'"},
+		{"powershell", true, "Remove-Item Env:NOMAD_ADDR -ErrorAction SilentlyContinue\nRemove-Item Env:NOMAD_TOKEN -ErrorAction SilentlyContinue"},
+		{"dotenv", false, "NOMAD_ADDR=https://192.168.105.13:4646\nNOMAD_TOKEN=\"it's a $secret\""},
+		{"dotenv", true, ""},
+		{"json", false, "{\n  \"NOMAD_ADDR\": \"https://192.168.105.13:4646\",\n  \"NOMAD_TOKEN\": \"it's a $secret\"\n}"},
+		{"json", true, "{\n  \"NOMAD_ADDR\": null,\n  \"NOMAD_TOKEN\": null\n}"},
+	}
+
+	for _, tt := range tests {
+		name := tt.shell
+		if tt.unset {
+			name += " unset"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			if got := formatEnvVars(vars, tt.shell, tt.unset); got != tt.want {
+				t.Errorf("formatEnvVars(%s, unset=%v) =\n%s\nwant\n%s", tt.shell, tt.unset, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright © 2024 Ranjandas Athiyanathum Poyil thejranjan@gmail.com
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ranjandas/shikari/app/shikari"
+	"github.com/spf13/cobra"
+)
+
+var (
+	envFiles []string // dotenv files with environment variables for the VMs
+	passEnv  []string // environment variables forwarded from the host
+)
+
+// loadEnvVars merges the environment variables of the VMs from all the
+// sources, in increasing order of precedence: --env-file, --pass-env and
+// --env, while --env-for overrides them per role or node. Licenses are
+// loaded last, for the variables not set by any of them.
+func loadEnvVars(cmd *cobra.Command, args []string) error {
+	var envs []string
+
+	for _, path := range envFiles {
+		vars, err := readEnvFile(path)
+		if err != nil {
+			return err
+		}
+
+		envs = append(envs, vars...)
+	}
+
+	for _, key := range passEnv {
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			return fmt.Errorf("environment variable %s to pass is not set on the host", key)
+		}
+
+		envs = append(envs, key+"="+value)
+	}
+
+	for _, e := range cluster.EnvVars {
+		v, err := resolveFileValue(e)
+		if err != nil {
+			return err
+		}
+
+		envs = append(envs, v)
+	}
+
+	cluster.EnvVars = shikari.MergeEnvVars(envs)
+
+	for i, s := range cluster.Secrets {
+		v, err := resolveFileValue(s)
+		if err != nil {
+			return err
+		}
+
+		cluster.Secrets[i] = v
+	}
+
+	for i, e := range cluster.NodeEnvVars {
+		target, env, _ := strings.Cut(e, ":")
+
+		v, err := resolveFileValue(env)
+		if err != nil {
+			return err
+		}
+
+		cluster.NodeEnvVars[i] = target + ":" + v
+	}
+
+	return loadLicenses(cmd, args)
+}
+
+// resolveFileValue reads the value of KEY=@path from the file at path.
+// A value starting with @@ is taken literally, with the first @ removed.
+func resolveFileValue(env string) (string, error) {
+	key, value, ok := strings.Cut(env, "=")
+	if !ok || !strings.HasPrefix(value, "@") {
+		return env, nil
+	}
+
+	if strings.HasPrefix(value, "@@") {
+		return key + "=" + value[1:], nil
+	}
+
+	data, err := os.ReadFile(value[1:])
+	if err != nil {
+		return "", fmt.Errorf("error reading the value of %s: %w", key, err)
+	}
+
+	return key + "=" + strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// readEnvFile parses the dotenv file at path into KEY=VALUE pairs. Lines may
+// start with export, and values may be single quoted (taken literally) or
+// double quoted (supporting the usual escape sequences).
+func readEnvFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var envs []string
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024) // licenses are long single lines
+
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: invalid line, expected KEY=VALUE", path, n)
+		}
+
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			value, err = strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid quoted value of %s: %w", path, n, key, err)
+			}
+
+		default:
+			// strip trailing comments of unquoted values
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+
+		envs = append(envs, key+"="+value)
+	}
+
+	return envs, scanner.Err()
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{"plain", "A=1\nB=two words\n", []string{"A=1", "B=two words"}, false},
+		{"comments and blank lines", "# comment\n\nA=1\n  # indented comment\n", []string{"A=1"}, false},
+		{"export prefix", "export A=1\nexport  B=2\n", []string{"A=1", "B=2"}, false},
+		{"single quoted", `A='it "is" $literal\n'`, []string{`A=it "is" $literal\n`}, false},
+		{"double quoted", `A="line\nnext \"quoted\""`, []string{"A=line\nnext \"quoted\""}, false},
+		{"trailing comment", "A=1 # the first\nB=a#b\n", []string{"A=1", "B=a#b"}, false},
+		{"quoted hash", `A="1 # not a comment"`, []string{"A=1 # not a comment"}, false},
+		{"spaces around the separator", "A = 1\n", []string{"A=1"}, false},
+		{"empty value", "A=\n", []string{"A="}, false},
+		{"value with equal signs", "A=b=c\n", []string{"A=b=c"}, false},
+		{"missing separator", "A\n", nil, true},
+		{"invalid escape", `A="\q"`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".env")
+
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readEnvFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readEnvFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("readEnvFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveFileValue(t *testing.T) {
+	dir := t.TempDir()
+
+	license := filepath.Join(dir, "consul.hclic")
+	if err := os.WriteFile(license, []byte("02MV4UU43BK5\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{"plain value", "A=1", "A=1", false},
+		{"no separator", "A", "A", false},
+		{"file", "CONSUL_LICENSE=@" + license, "CONSUL_LICENSE=02MV4UU43BK5", false},
+		{"escaped at sign", "A=@@literal", "A=@literal", false},
+		{"at sign inside the value", "A=user@host", "A=user@host", false},
+		{"missing file", "A=@" + filepath.Join(dir, "missing"), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveFileValue(tt.env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveFileValue(%q) error = %v, wantErr %v", tt.env, err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("resolveFileValue(%q) = %q, want %q", tt.env, got, tt.want)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	lima "github.com/ranjandas/shikari/app/lima"
+	"github.com/ranjandas/shikari/app/shikari"
 	"github.com/spf13/cobra"
 )
 
@@ -18,7 +19,8 @@ var execCmd = &cobra.Command{
 	Short: "Execute commands inside the VMs",
 	Long: `Execute commands inside the VMs. For example:
 
-You can run commands against specific class of servers (clients, servers or all)`,
+You can run commands against specific class of servers (clients, servers or all),
+a specific instance or the instances matching a selector (eg: --target zone-a)`,
 	Run: func(cmd *cobra.Command, args []string) {
 
 		quiet, _ := cmd.Flags().GetBool("quiet")
@@ -26,6 +28,7 @@ You can run commands against specific class of servers (clients, servers or all)
 		execServers, _ := cmd.Flags().GetBool("servers")
 		execClients, _ := cmd.Flags().GetBool("clients")
 		execInstance, _ := cmd.Flags().GetString("instance")
+		execTarget, _ := cmd.Flags().GetString("target")
 
 		clusterName, _ := cmd.Flags().GetString("name")
 
@@ -64,6 +67,18 @@ You can run commands against specific class of servers (clients, servers or all)
 			}
 		}
 
+		if execTarget != "" {
+			selected, err := shikari.ShikariCluster{Name: clusterName}.SelectInstances(execTarget)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+
+			for _, vmName := range lima.GetInstancesByStatus(selected, "running") {
+				lima.ExecLimaVM(vmName.Name, strings.Join(args, " "), quiet)
+			}
+		}
+
 		var instanceExists bool
 		if execInstance != "" {
 			for _, vmName := range instances {
@@ -89,7 +104,8 @@ func init() {
 	execCmd.Flags().BoolP("all", "a", false, "run commands against all instances in the cluster")
 	execCmd.Flags().StringP("instance", "i", "", "name of the specific instance to run the command against")
 	execCmd.Flags().StringP("name", "n", "", "name of the cluster to run the command against")
+	execCmd.Flags().String("target", "", "run commands against the instances matching the selector, eg: zone-a or servers,cli-01")
 
-	execCmd.MarkFlagsMutuallyExclusive("clients", "servers", "all", "instance")
+	execCmd.MarkFlagsMutuallyExclusive("clients", "servers", "all", "instance", "target")
 
 }
@@ -0,0 +1,59 @@
+/*
+Copyright © 2024 Ranjandas Athiyanathum Poyil thejranjan@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports a cluster into an archive",
+	Long: `Exports the state of a cluster and the configuration and disks of all its
+VMs into an archive, which can be imported on another host with the import
+command. The compression is picked from the file extension (.tar.zst, .tar.gz
+or .tar). The VMs are stopped during the export and started again afterwards.
+
+The archive is only readable by the user. The CA key, the Vault unseal keys
+and root token and the secrets of the cluster are left out unless
+--include-secrets is passed. The VM disks are exported as they are, including
+the certificates and secrets already installed into the VMs.
+
+Example:
+
+$ shikari export -n murphy -o murphy.tar.zst`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(lima.GetInstancesByPrefix(cluster.Name)) == 0 {
+			fmt.Printf("Cluster \"%s\" not found.\n", cluster.Name)
+			return
+		}
+
+		if err := cluster.Export(exportOutput, exportIncludeSecrets); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		fmt.Printf("Cluster %s exported to %s\n", cluster.Name, exportOutput)
+	},
+}
+
+var (
+	exportOutput         string
+	exportIncludeSecrets bool
+)
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVarP(&cluster.Name, "name", "n", "", "name of the cluster")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "path of the archive to create")
+	exportCmd.Flags().BoolVar(&exportIncludeSecrets, "include-secrets", false, "include the CA key, the Vault keys and the secrets of the cluster in the archive")
+
+	exportCmd.MarkFlagRequired("name")
+	exportCmd.MarkFlagRequired("output")
+}
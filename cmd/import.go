@@ -0,0 +1,44 @@
+/*
+Copyright © 2024 Ranjandas Athiyanathum Poyil thejranjan@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/ranjandas/shikari/app/shikari"
+	"github.com/spf13/cobra"
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Imports a cluster from an archive",
+	Long: `Imports a cluster from an archive created by the export command. The
+cluster keeps its original name unless a new one is passed with --name. The
+imported VMs are left stopped.
+
+Example:
+
+$ shikari import -f murphy.tar.zst --name murphy2`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, err := shikari.Import(importFile, cluster.Name)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		fmt.Printf("Cluster %s imported. Start it with: shikari start -n %s\n", name, name)
+	},
+}
+
+var importFile string
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	importCmd.Flags().StringVarP(&importFile, "file", "f", "", "path of the archive to import")
+	importCmd.Flags().StringVarP(&cluster.Name, "name", "n", "", "name of the imported cluster (defaults to the name in the archive)")
+
+	importCmd.MarkFlagRequired("file")
+}
@@ -27,7 +27,8 @@ var licenseListCmd = &cobra.Command{
 		}
 
 		for _, l := range licenses {
-			fmt.Printf("%s will be loaded as default value for environment variable %s\n", l, licenseEnvVarKey(l))
+			key := licenseEnvVarKey(l)
+			fmt.Printf("%s will be loaded as default value for secret %s (path in environment variable %s_PATH)\n", l, key, key)
 		}
 
 		return nil
@@ -74,9 +75,12 @@ func loadLicenses(cmd *cobra.Command, args []string) error {
 func loadLicense(path string) error {
 	envVarKey := licenseEnvVarKey(path)
 
-	if !slices.ContainsFunc(cluster.EnvVars, func(v string) bool {
-		return strings.HasPrefix(v, envVarKey)
-	}) {
+	isSet := func(v string) bool {
+		return strings.HasPrefix(v, envVarKey+"=")
+	}
+
+	// licenses are copied into the VMs as secrets, unless given explicitly
+	if !slices.ContainsFunc(cluster.EnvVars, isSet) && !slices.ContainsFunc(cluster.Secrets, isSet) {
 		if _, err := os.Stat(path); err != nil {
 			return err
 		}
@@ -86,7 +90,7 @@ func loadLicense(path string) error {
 			return err
 		}
 
-		cluster.EnvVars = append(cluster.EnvVars, envVarKey+"="+strings.TrimSpace(string(license)))
+		cluster.Secrets = append(cluster.Secrets, envVarKey+"="+strings.TrimSpace(string(license)))
 	}
 	return nil
 }
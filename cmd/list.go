@@ -40,7 +40,7 @@ func listInstances(clusterName string) {
 	w := tabwriter.NewWriter(os.Stdout, 4, 8, 4, byte(' '), 0)
 
 	if !noheader {
-		fmt.Fprintln(w, "CLUSTER\tVM NAME\tARCH\tIP(lima0)\tSTATUS\tSCENARIO\tDISK(GB)\tMEMORY(GB)\tCPUS\tIMAGE")
+		fmt.Fprintln(w, "CLUSTER\tVM NAME\tARCH\tIP(lima0)\tSTATUS\tSCENARIO\tZONE\tDISK(GB)\tMEMORY(GB)\tCPUS\tIMAGE")
 	}
 
 	for _, vm := range vms {
@@ -51,9 +51,9 @@ func listInstances(clusterName string) {
 					continue //skip printing the
 				}
 			}
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n", getClusterNameFromInstanceName(vm.Name),
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n", getClusterNameFromInstanceName(vm.Name),
 				vm.Name, vm.Arch, vm.GetIPAddress(),
-				vm.Status, vm.GetScenarioNameFromEnv(),
+				vm.Status, vm.GetScenarioNameFromEnv(), vm.GetZoneFromEnv(),
 				bytesToGiB(vm.Disk), bytesToGiB(vm.Memory),
 				vm.Cpus,
 				getImageLocation(vm),
@@ -0,0 +1,80 @@
+/*
+Copyright © 2024 Ranjandas Athiyanathum Poyil thejranjan@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+	"github.com/ranjandas/shikari/app/shikari"
+	"github.com/spf13/cobra"
+)
+
+// proxyCmd represents the proxy command
+var proxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Runs a local proxy load-balancing the cluster APIs",
+	Long: `Runs a local TCP proxy for the API ports of the products (both plain and
+TLS), forwarding the connections round-robin to the running servers of the
+cluster that accept them. Use it with "shikari env --via-proxy" so that the
+environment keeps working when servers are stopped or replaced.
+
+Example:
+
+$ shikari proxy -n murphy
+$ eval $(shikari env -n murphy --via-proxy consul,nomad)`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(lima.GetInstancesByPrefix(cluster.Name)) == 0 {
+			fmt.Printf("Cluster \"%s\" not found.\n", cluster.Name)
+			return
+		}
+
+		products, err := shikari.LoadProducts()
+		if err != nil {
+			fmt.Println("Error loading product definitions:", err)
+			return
+		}
+
+		if len(proxyProducts) == 0 {
+			proxyProducts = shikari.ProductNames(products)
+		}
+
+		var ports []int
+
+		for _, name := range proxyProducts {
+			p, ok := products[name]
+			if !ok {
+				fmt.Println("Invalid product name", name)
+				return
+			}
+
+			for _, port := range []int{p.Port, p.TLSPort} {
+				if !slices.Contains(ports, port) {
+					ports = append(ports, port)
+				}
+			}
+		}
+
+		if err := cluster.RunProxy(proxyBind, ports, proxyRefresh); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var proxyProducts []string
+var proxyBind string
+var proxyRefresh time.Duration
+
+func init() {
+	rootCmd.AddCommand(proxyCmd)
+
+	proxyCmd.Flags().StringVarP(&cluster.Name, "name", "n", "", "name of the cluster")
+	proxyCmd.Flags().StringSliceVarP(&proxyProducts, "products", "p", []string{}, "products to proxy the API ports of (defaults to all)")
+	proxyCmd.Flags().StringVar(&proxyBind, "bind", "127.0.0.1", "address to listen on")
+	proxyCmd.Flags().DurationVar(&proxyRefresh, "refresh", 15*time.Second, "how often the running servers are looked up")
+
+	proxyCmd.MarkFlagRequired("name")
+}
@@ -0,0 +1,63 @@
+/*
+Copyright © 2024 Ranjandas Athiyanathum Poyil thejranjan@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+	"github.com/spf13/cobra"
+)
+
+// removeCmd represents the remove command
+var removeCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Removes a specific VM from a cluster",
+	Long: `Removes a specific VM from a cluster. The numbering of the remaining VMs
+is left untouched, and a later scale up fills the gap first.
+
+Example:
+
+$ shikari remove murphy-srv-02 -f`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !(len(args) > 0) {
+			fmt.Println("No Instance name passed")
+			return
+		}
+
+		vm := lima.GetInstance(args[0])
+		// return if no instance with the name was found
+		if vm.Name == "" || !isShikariVM(vm.Name) {
+			fmt.Printf("No instance found with the name \"%s\"\n", args[0])
+			return
+		}
+
+		if vm.Status == "Running" && !cluster.Force {
+			fmt.Printf("Instance %s is running. Rerun the command with -f to force the removal!\n", vm.Name)
+			return
+		}
+
+		var wg sync.WaitGroup
+		errCh := make(chan error, 1)
+
+		wg.Add(1)
+		lima.DeleteLimaVM(vm.Name, cluster.Force, &wg, errCh)
+
+		close(errCh)
+
+		for err := range errCh {
+			fmt.Println(err)
+		}
+
+		// the state goes along with the last VM of the cluster
+		cleanupCluster(getClusterNameFromInstanceName(vm.Name))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(removeCmd)
+
+	removeCmd.Flags().BoolVarP(&cluster.Force, "force", "f", false, "force removal of the VM even when it is running")
+}
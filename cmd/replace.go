@@ -0,0 +1,54 @@
+/*
+Copyright © 2024 Ranjandas Athiyanathum Poyil thejranjan@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+	"github.com/spf13/cobra"
+)
+
+// replaceCmd represents the replace command
+var replaceCmd = &cobra.Command{
+	Use:   "replace",
+	Short: "Destroys and recreates a VM of a cluster",
+	Long: `Destroys and recreates a VM of a cluster with the same name, role and
+environment variables. This is useful to simulate the failure and recovery of
+a node.
+
+Example:
+
+$ shikari replace murphy-srv-02 -f`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !(len(args) > 0) {
+			fmt.Println("No Instance name passed")
+			return
+		}
+
+		vm := lima.GetInstance(args[0])
+		// return if no instance with the name was found
+		if vm.Name == "" || !isShikariVM(vm.Name) {
+			fmt.Printf("No instance found with the name \"%s\"\n", args[0])
+			return
+		}
+
+		if vm.Status == "Running" && !cluster.Force {
+			fmt.Printf("Instance %s is running. Rerun the command with -f to force the replacement!\n", vm.Name)
+			return
+		}
+
+		cluster.Name = getClusterNameFromInstanceName(vm.Name)
+
+		if err := cluster.ReplaceInstance(vm.Name, "", nil); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(replaceCmd)
+
+	replaceCmd.Flags().BoolVarP(&cluster.Force, "force", "f", false, "force replacement of the VM even when it is running")
+}
@@ -0,0 +1,58 @@
+/*
+Copyright © 2024 Ranjandas Athiyanathum Poyil thejranjan@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+	"github.com/ranjandas/shikari/app/shikari"
+	"github.com/spf13/cobra"
+)
+
+// rolloutCmd represents the rollout command
+var rolloutCmd = &cobra.Command{
+	Use:   "rollout",
+	Short: "Replaces or restarts the VMs of a cluster one at a time",
+	Long: `Replaces or restarts the VMs of a cluster one at a time, servers first and
+then clients. After each VM, the products that reported a leader on the VM
+before it was touched (Consul, Nomad, Vault or any product definition with a
+leader_path) must report one again before the rollout moves on, and the rollout
+stops at the first failure. --wait-for adds products to wait for, eg: for VMs
+that are not running or not healthy yet.
+
+Example:
+
+$ shikari rollout -n murphy --image c-1.19-n-1.8.qcow2 --wait-for consul,nomad
+$ shikari rollout -n murphy --restart --wait-for consul`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(lima.GetInstancesByPrefix(cluster.Name)) == 0 {
+			fmt.Printf("Cluster \"%s\" not found.\n", cluster.Name)
+			return
+		}
+
+		if err := cluster.Rollout(rolloutOpts); err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		fmt.Printf("\nRollout of cluster %s completed successfully.\n", cluster.Name)
+	},
+}
+
+var rolloutOpts shikari.RolloutOpts
+
+func init() {
+	rootCmd.AddCommand(rolloutCmd)
+
+	rolloutCmd.Flags().StringVarP(&cluster.Name, "name", "n", "", "name of the cluster")
+	rolloutCmd.Flags().StringVarP(&cluster.ImgPath, "image", "i", "", "path to the qcow2 image the VMs are replaced with")
+	rolloutCmd.Flags().BoolVarP(&rolloutOpts.Restart, "restart", "r", false, "restart the VMs instead of replacing them")
+	rolloutCmd.Flags().StringSliceVarP(&rolloutOpts.Products, "wait-for", "w", []string{}, "products to wait for between the steps, besides the ones detected on each VM (consul, nomad, vault)")
+	rolloutCmd.Flags().DurationVar(&rolloutOpts.Timeout, "timeout", 5*time.Minute, "how long to wait for the products to become healthy on each VM")
+
+	rolloutCmd.MarkFlagRequired("name")
+	rolloutCmd.MarkFlagsMutuallyExclusive("image", "restart")
+}
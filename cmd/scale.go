@@ -4,17 +4,50 @@ Copyright © 2024 Ranjandas Athiyanathum Poyil thejranjan@gmail.com
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/ranjandas/shikari/app/shikari"
 	"github.com/spf13/cobra"
 )
 
 // scaleCmd represents the scale command
 var scaleCmd = &cobra.Command{
-	Use:     "scale",
-	Short:   "Scale the number of VMs in the cluster",
-	Long:    `Scale the number of VMs in the cluster`,
-	PreRunE: loadLicenses,
+	Use:   "scale",
+	Short: "Scale the number of VMs in the cluster",
+	Long: `Scale the number of VMs in the cluster
+
+Only the counts passed as flags are changed. An explicit zero removes all the
+VMs of that kind, for example all the clients while keeping the servers:
+
+$ shikari scale -n murphy --clients 0 -f`,
+	PreRunE: loadEnvVars,
 	Run: func(cmd *cobra.Command, args []string) {
+		cluster.ScaleServers = cmd.Flags().Changed("servers")
+		cluster.ScaleClients = cmd.Flags().Changed("clients")
+
+		// the VMs are added with the template, architecture and image of the cluster unless given
+		state, err := shikari.LoadState(cluster.Name)
+		if err != nil {
+			fmt.Printf("Error loading the state of cluster %s: %v\n", cluster.Name, err)
+			return
+		}
+
+		if !cmd.Flags().Changed("template") && state.Template != "" {
+			cluster.Template = state.Template
+		}
+
+		if !cmd.Flags().Changed("arch") && state.Arch != "" {
+			cluster.Arch = state.Arch
+		}
+
+		if !cmd.Flags().Changed("image") && state.Image != "" {
+			cluster.ImgPath = state.Image
+		}
+
 		cluster.CreateCluster(true)
+
+		// the state goes along with the last VM of the cluster
+		cleanupCluster(cluster.Name)
 	},
 }
 
@@ -24,11 +57,15 @@ func init() {
 	scaleCmd.Flags().Uint8VarP(&cluster.NumServers, "servers", "s", 0, "number of servers")
 	scaleCmd.Flags().Uint8VarP(&cluster.NumClients, "clients", "c", 0, "number of clients")
 	scaleCmd.Flags().StringVarP(&cluster.Name, "name", "n", "", "name of the cluster")
-	scaleCmd.Flags().StringVarP(&cluster.Template, "template", "t", "./hashibox.yaml", "name of lima template for the VMs")
-	scaleCmd.Flags().StringSliceVarP(&cluster.EnvVars, "env", "e", []string{}, "provide environment vars in the for key=value (can be used multiple times)")
-	scaleCmd.Flags().StringVarP(&cluster.ImgPath, "image", "i", "", "path to the cqow2 images to be used for the VMs, overriding the one in the template")
+	scaleCmd.Flags().StringVarP(&cluster.Template, "template", "t", "./hashibox.yaml", "name of lima template for the VMs (defaults to the one the cluster was created with)")
+	scaleCmd.Flags().StringArrayVarP(&cluster.EnvVars, "env", "e", []string{}, "provide environment vars in the form key=value, or key=@path to read the value from a file (can be used multiple times)")
+	scaleCmd.Flags().StringArrayVar(&cluster.NodeEnvVars, "env-for", []string{}, "override environment vars per role or VM in the form servers|clients|srv-NN|cli-NN:key=value (can be used multiple times)")
+	scaleCmd.Flags().StringArrayVar(&envFiles, "env-file", []string{}, "read environment vars from a dotenv file (can be used multiple times)")
+	scaleCmd.Flags().StringArrayVar(&passEnv, "pass-env", []string{}, "pass the environment var with the given name from the host (can be used multiple times)")
+	scaleCmd.Flags().StringArrayVar(&cluster.Secrets, "secret", []string{}, "provide secrets in the form key=value or key=@path, copied into the VMs as files exposed through key_PATH (can be used multiple times)")
+	scaleCmd.Flags().StringVarP(&cluster.ImgPath, "image", "i", "", "path to the cqow2 images to be used for the VMs, overriding the one in the template (defaults to the one the cluster was created or rolled out with)")
 	scaleCmd.Flags().BoolVarP(&cluster.Force, "force", "f", false, "force scaling down of the cluster VMs")
-	scaleCmd.Flags().StringVarP(&cluster.Arch, "arch", "a", "aarch64", "the architecture of the VM (supported by Lima). Eg: aarch64, s390x")
+	scaleCmd.Flags().StringVarP(&cluster.Arch, "arch", "a", "aarch64", "the architecture of the VM (supported by Lima), defaults to the one the cluster was created with. Eg: aarch64, s390x")
 
 	scaleCmd.MarkFlagRequired("name")
 	scaleCmd.MarkFlagsOneRequired("clients", "servers")
@@ -0,0 +1,117 @@
+/*
+Copyright © 2024 Ranjandas Athiyanathum Poyil thejranjan@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+	"github.com/spf13/cobra"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage snapshots of all the VMs of a cluster",
+	Long: `Manage snapshots of all the VMs of a cluster under a common tag.
+
+The VMs are stopped while the snapshots are created, applied or deleted, and
+the VMs that were running are started again afterwards.
+
+Example:
+
+$ shikari snapshot create -n murphy bootstrapped
+$ shikari snapshot list -n murphy
+$ shikari snapshot apply -n murphy bootstrapped
+$ shikari snapshot delete -n murphy bootstrapped`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if len(lima.GetInstancesByPrefix(cluster.Name)) == 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("cluster %q not found", cluster.Name)
+		}
+
+		return nil
+	},
+}
+
+var snapshotCreateCmd = &cobra.Command{
+	Use:   "create <tag>",
+	Short: "Snapshot all the VMs of the cluster",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cluster.CreateSnapshot(args[0]); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var snapshotApplyCmd = &cobra.Command{
+	Use:   "apply <tag>",
+	Short: "Restore all the VMs of the cluster to a snapshot",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cluster.ApplySnapshot(args[0]); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete <tag>",
+	Short: "Delete a snapshot from all the VMs of the cluster",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cluster.DeleteSnapshot(args[0]); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the snapshots of the cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		snapshots, err := cluster.ListSnapshots()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		var tags []string
+		for tag := range snapshots {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+
+		vmCount := len(lima.GetInstancesByPrefix(cluster.Name))
+
+		w := tabwriter.NewWriter(os.Stdout, 4, 8, 4, byte(' '), 0)
+
+		if !noheader {
+			fmt.Fprintln(w, "TAG\tCOMPLETE\tVMS")
+		}
+
+		for _, tag := range tags {
+			fmt.Fprintf(w, "%s\t%t\t%s\n", tag, len(snapshots[tag]) == vmCount, strings.Join(snapshots[tag], ","))
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCmd.AddCommand(snapshotApplyCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+
+	snapshotCmd.PersistentFlags().StringVarP(&cluster.Name, "name", "n", "", "name of the cluster")
+	snapshotCmd.MarkPersistentFlagRequired("name")
+
+	snapshotListCmd.Flags().BoolVarP(&noheader, "no-header", "", false, "skip the header from list output")
+}
@@ -52,6 +52,11 @@ $ shikari start -n murphy`,
 		for err := range errCh {
 			fmt.Println(err)
 		}
+
+		// eg: the VMs of an imported cluster, started for the first time
+		if err := cluster.FinishProvisioning(); err != nil {
+			fmt.Println(err)
+		}
 	},
 }
 
@@ -37,7 +37,7 @@ var stopCmd = &cobra.Command{
 		// Stop Lima VMs concurrently
 		for _, vmName := range runningInstances {
 			wg.Add(1)
-			go lima.StopLimaVM(vmName.Name, &wg, errCh)
+			go lima.StopLimaVM(vmName.Name, false, &wg, errCh)
 		}
 
 		// Wait for all goroutines to finish
@@ -0,0 +1,97 @@
+/*
+Copyright © 2024 Ranjandas Athiyanathum Poyil thejranjan@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	lima "github.com/ranjandas/shikari/app/lima"
+	"github.com/ranjandas/shikari/app/shikari"
+	"github.com/spf13/cobra"
+)
+
+// vaultCmd represents the vault command
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "Initialize and unseal Vault running in a cluster",
+	Long: `Initialize and unseal Vault running on the servers of a cluster.
+
+The unseal keys and the root token are stored in the state directory of the
+cluster (~/.shikari/clusters/<name>/) and the root token is printed by
+"shikari env --acl vault".
+
+Example:
+
+$ shikari vault init -n murphy
+$ shikari vault unseal -n murphy
+$ shikari vault status -n murphy`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		if len(lima.GetInstancesByPrefix(cluster.Name)) == 0 {
+			fmt.Printf("Cluster \"%s\" not found.\n", cluster.Name)
+			os.Exit(1)
+		}
+	},
+}
+
+var vaultInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Initialize Vault on the first server of the cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cluster.VaultInit(vaultOpts); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var vaultUnsealCmd = &cobra.Command{
+	Use:   "unseal",
+	Short: "Unseal Vault on all the servers of the cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cluster.VaultUnseal(vaultOpts); err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+var vaultStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Print the Vault status of all the servers of the cluster",
+	Run: func(cmd *cobra.Command, args []string) {
+		statuses, err := cluster.VaultStatus(vaultOpts)
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 4, 8, 4, byte(' '), 0)
+
+		if !noheader {
+			fmt.Fprintln(w, "VM NAME\tINITIALIZED\tSEALED\tHA MODE")
+		}
+
+		for _, s := range statuses {
+			fmt.Fprintf(w, "%s\t%t\t%t\t%s\n", s.VMName, s.Initialized, s.Sealed, s.HAMode)
+		}
+		w.Flush()
+	},
+}
+
+var vaultOpts shikari.VaultOpts
+
+func init() {
+	rootCmd.AddCommand(vaultCmd)
+	vaultCmd.AddCommand(vaultInitCmd)
+	vaultCmd.AddCommand(vaultUnsealCmd)
+	vaultCmd.AddCommand(vaultStatusCmd)
+
+	vaultCmd.PersistentFlags().StringVarP(&cluster.Name, "name", "n", "", "name of the cluster")
+	vaultCmd.PersistentFlags().BoolVarP(&vaultOpts.TLS, "tls", "t", false, "the Vault listener has TLS enabled")
+	vaultCmd.MarkPersistentFlagRequired("name")
+
+	vaultInitCmd.Flags().IntVar(&vaultOpts.KeyShares, "key-shares", 5, "number of unseal key shares")
+	vaultInitCmd.Flags().IntVar(&vaultOpts.KeyThreshold, "key-threshold", 3, "number of unseal key shares required to unseal")
+
+	vaultStatusCmd.Flags().BoolVarP(&noheader, "no-header", "", false, "skip the header from the output")
+}
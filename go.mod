@@ -3,7 +3,11 @@ module github.com/ranjandas/shikari
 // X.Y format only supported under vscode
 go 1.22.0
 
-require github.com/spf13/cobra v1.8.0
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/spf13/cobra v1.8.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect